@@ -0,0 +1,310 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Addr       string
+	DBPath     string
+	SchemaPath string
+	StaticDir  string
+	UploadDir  string
+
+	// SessionTTL is how long a session row stays valid in the database;
+	// CookieTTL is the lifetime of the browser cookie that carries it.
+	SessionTTL       time.Duration
+	CookieTTL        time.Duration
+	SessionRotation  time.Duration
+	MaxUploadSize    int64
+	WSWriteWait      time.Duration
+	WSPongWait       time.Duration
+	WSMaxMessageSize int64
+	ShutdownTimeout  time.Duration
+	// ReconnectHint is sent to websocket clients on shutdown as the delay
+	// they should wait before reconnecting.
+	ReconnectHint time.Duration
+
+	// PubSub selects how websocket events reach other instances: "memory"
+	// for a single instance, or a redis:// URL.
+	PubSub           string
+	InstanceID       string
+	PresenceInterval time.Duration
+
+	// TypingTimeout is how long a typing indicator lasts without being
+	// refreshed by the client; TypingRate caps typing frames per second
+	// per connection.
+	TypingTimeout time.Duration
+	TypingRate    float64
+
+	// IdleTimeout is how long a connected user may send no activity before
+	// they are shown as away.
+	IdleTimeout time.Duration
+
+	// Admin is the nickname or email of an account made admin at startup.
+	// Nobody is made admin otherwise, so a new forum needs it once its
+	// operator has registered.
+	Admin string
+
+	// PublishInterval is how often scheduled posts are checked for being
+	// due.
+	PublishInterval time.Duration
+
+	// BlockedWords is a comma-separated list of words or phrases that the
+	// content filter masks or, with BlocklistAction "reject", refuses.
+	// MaxLinks caps the links in one post, comment or message; zero means
+	// no limit.
+	BlockedWords    string
+	BlocklistAction string
+	MaxLinks        int
+}
+
+func Default() *Config {
+	return &Config{
+		Addr:             ":8080",
+		DBPath:           "./forum.db",
+		SchemaPath:       "schema.sql",
+		StaticDir:        "static",
+		UploadDir:        "./static/uploads/avatars",
+		SessionTTL:       7 * 24 * time.Hour,
+		CookieTTL:        24 * time.Hour,
+		SessionRotation:  12 * time.Hour,
+		MaxUploadSize:    10 << 20,
+		WSWriteWait:      10 * time.Second,
+		WSPongWait:       60 * time.Second,
+		WSMaxMessageSize: 10000,
+		ShutdownTimeout:  15 * time.Second,
+		ReconnectHint:    5 * time.Second,
+		PubSub:           "memory",
+		PresenceInterval: 10 * time.Second,
+		TypingTimeout:    6 * time.Second,
+		TypingRate:       4,
+		IdleTimeout:      5 * time.Minute,
+		PublishInterval:  15 * time.Second,
+		BlocklistAction:  "mask",
+		MaxLinks:         5,
+	}
+}
+
+var current = Default()
+
+// Get returns the configuration installed by Set, or the defaults.
+func Get() *Config {
+	return current
+}
+
+// Set installs cfg as the process-wide configuration. It is meant to be
+// called once from main before the server starts.
+func Set(cfg *Config) {
+	current = cfg
+}
+
+// WSPingPeriod is how often the server pings websocket clients; it must be
+// shorter than WSPongWait.
+func (c *Config) WSPingPeriod() time.Duration {
+	return (c.WSPongWait * 9) / 10
+}
+
+func (c *Config) flagSet(output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("rtf", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	fs.String("config", "", "path to a JSON config file (env RTF_CONFIG)")
+	fs.StringVar(&c.Addr, "addr", c.Addr, "HTTP listen address")
+	fs.StringVar(&c.DBPath, "db-path", c.DBPath, "SQLite database file")
+	fs.StringVar(&c.SchemaPath, "schema-path", c.SchemaPath, "schema.sql location")
+	fs.StringVar(&c.StaticDir, "static-dir", c.StaticDir, "directory served under /static/")
+	fs.StringVar(&c.UploadDir, "upload-dir", c.UploadDir, "directory for avatar uploads")
+	fs.DurationVar(&c.SessionTTL, "session-ttl", c.SessionTTL, "session lifetime in the database")
+	fs.DurationVar(&c.CookieTTL, "cookie-ttl", c.CookieTTL, "session cookie lifetime")
+	fs.DurationVar(&c.SessionRotation, "session-rotation", c.SessionRotation, "how often session IDs are rotated")
+	fs.Int64Var(&c.MaxUploadSize, "max-upload-size", c.MaxUploadSize, "maximum upload size in bytes")
+	fs.DurationVar(&c.WSWriteWait, "ws-write-wait", c.WSWriteWait, "websocket write timeout")
+	fs.DurationVar(&c.WSPongWait, "ws-pong-wait", c.WSPongWait, "websocket read timeout between pongs")
+	fs.Int64Var(&c.WSMaxMessageSize, "ws-max-message-size", c.WSMaxMessageSize, "maximum websocket frame size in bytes")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "time allowed for draining connections on shutdown")
+	fs.DurationVar(&c.ReconnectHint, "reconnect-hint", c.ReconnectHint, "reconnect delay suggested to websocket clients on shutdown")
+	fs.StringVar(&c.PubSub, "pubsub", c.PubSub, `websocket event bus: "memory" or redis://[:password@]host:port`)
+	fs.StringVar(&c.InstanceID, "instance-id", c.InstanceID, "name of this instance in the cluster (random when empty)")
+	fs.DurationVar(&c.PresenceInterval, "presence-interval", c.PresenceInterval, "how often presence is announced to other instances")
+	fs.DurationVar(&c.TypingTimeout, "typing-timeout", c.TypingTimeout, "how long a typing indicator lasts without a refresh")
+	fs.Float64Var(&c.TypingRate, "typing-rate", c.TypingRate, "maximum typing frames per second per connection")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "inactivity after which a user is shown as away")
+	fs.StringVar(&c.Admin, "admin", c.Admin, "nickname or email of an existing account to make admin at startup")
+	fs.DurationVar(&c.PublishInterval, "publish-interval", c.PublishInterval, "how often scheduled posts are checked for being due")
+	fs.StringVar(&c.BlockedWords, "blocked-words", c.BlockedWords, "comma-separated words or phrases caught by the content filter")
+	fs.StringVar(&c.BlocklistAction, "blocklist-action", c.BlocklistAction, `what to do with blocked words: "mask" or "reject"`)
+	fs.IntVar(&c.MaxLinks, "max-links", c.MaxLinks, "maximum links per post, comment or message (0 for no limit)")
+
+	return fs
+}
+
+// Load builds a Config from, in increasing order of precedence: the
+// defaults, a JSON config file, RTF_* environment variables and the
+// command-line arguments. Setting names are shared: "db-path" is
+// {"db-path": ...} in the file, RTF_DB_PATH in the environment and
+// -db-path on the command line.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	fs := cfg.flagSet(os.Stderr)
+
+	// Parse once to learn -config; flags are parsed again after the file
+	// and environment so that they win.
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = os.Getenv("RTF_CONFIG")
+	}
+	if path != "" {
+		if err := applyFile(fs, path); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s: %v", envName(f.Name), setErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func envName(setting string) string {
+	return "RTF_" + strings.ToUpper(strings.ReplaceAll(setting, "-", "_"))
+}
+
+func applyFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	// UseNumber keeps large integers such as upload sizes out of float64
+	// exponent notation when they are turned back into strings.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var values map[string]interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+
+	for name, value := range values {
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q in config file %s", name, path)
+		}
+		var text string
+		switch value := value.(type) {
+		case string:
+			text = value
+		case json.Number:
+			text = value.String()
+		case bool:
+			text = strconv.FormatBool(value)
+		default:
+			return fmt.Errorf("invalid %q in config file %s: must be a string, number or boolean", name, path)
+		}
+		if err := fs.Set(name, text); err != nil {
+			return fmt.Errorf("invalid %q in config file %s: %v", name, path, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Addr == "" {
+		problems = append(problems, "addr must not be empty")
+	}
+	if c.DBPath == "" {
+		problems = append(problems, "db-path must not be empty")
+	}
+	if _, err := os.Stat(c.SchemaPath); err != nil {
+		problems = append(problems, fmt.Sprintf("schema-path: %v", err))
+	}
+	if info, err := os.Stat(c.StaticDir); err != nil || !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("static-dir %q is not a directory", c.StaticDir))
+	}
+	if c.UploadDir == "" {
+		problems = append(problems, "upload-dir must not be empty")
+	}
+	if c.SessionTTL <= 0 || c.CookieTTL <= 0 || c.SessionRotation <= 0 {
+		problems = append(problems, "session-ttl, cookie-ttl and session-rotation must be positive")
+	}
+	if c.CookieTTL > c.SessionTTL {
+		problems = append(problems, "cookie-ttl must not exceed session-ttl")
+	}
+	if c.MaxUploadSize <= 0 {
+		problems = append(problems, "max-upload-size must be positive")
+	}
+	if c.WSWriteWait <= 0 || c.WSPongWait <= 0 {
+		problems = append(problems, "ws-write-wait and ws-pong-wait must be positive")
+	}
+	if c.WSMaxMessageSize <= 0 {
+		problems = append(problems, "ws-max-message-size must be positive")
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdown-timeout must be positive")
+	}
+	if c.ReconnectHint < 0 {
+		problems = append(problems, "reconnect-hint must not be negative")
+	}
+	if c.PubSub != "memory" && !strings.HasPrefix(c.PubSub, "redis://") {
+		problems = append(problems, `pubsub must be "memory" or a redis:// URL`)
+	}
+	if c.PresenceInterval <= 0 {
+		problems = append(problems, "presence-interval must be positive")
+	}
+	if c.TypingTimeout <= 0 || c.TypingRate <= 0 {
+		problems = append(problems, "typing-timeout and typing-rate must be positive")
+	}
+	if c.IdleTimeout <= 0 {
+		problems = append(problems, "idle-timeout must be positive")
+	}
+	if c.PublishInterval <= 0 {
+		problems = append(problems, "publish-interval must be positive")
+	}
+	if c.BlocklistAction != "mask" && c.BlocklistAction != "reject" {
+		problems = append(problems, `blocklist-action must be "mask" or "reject"`)
+	}
+	if c.MaxLinks < 0 {
+		problems = append(problems, "max-links must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes settings as a config file, pointing schema-path and
+// static-dir at temporary paths so that the result passes Validate.
+func writeConfig(t *testing.T, settings map[string]interface{}) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	schema := filepath.Join(dir, "schema.sql")
+	if err := os.WriteFile(schema, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings["schema-path"] = schema
+	settings["static-dir"] = dir
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, map[string]interface{}{
+		"addr":            ":1000",
+		"max-links":       3,
+		"typing-timeout":  "2s",
+		"max-upload-size": 1000000,
+		"pubsub":          "redis://file:6379",
+	})
+	t.Setenv("RTF_CONFIG", path)
+	t.Setenv("RTF_ADDR", ":2000")
+	t.Setenv("RTF_MAX_LINKS", "4")
+
+	cfg, err := Load([]string{"-max-links", "7"})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if cfg.Addr != ":2000" {
+		t.Errorf("environment should override the file: addr = %q", cfg.Addr)
+	}
+	if cfg.MaxLinks != 7 {
+		t.Errorf("flags should override the environment: max-links = %d", cfg.MaxLinks)
+	}
+	if cfg.TypingTimeout != 2*time.Second || cfg.PubSub != "redis://file:6379" {
+		t.Errorf("file settings not applied: typing-timeout = %v, pubsub = %q", cfg.TypingTimeout, cfg.PubSub)
+	}
+	if cfg.MaxUploadSize != 1000000 {
+		t.Errorf("max-upload-size = %d, want 1000000", cfg.MaxUploadSize)
+	}
+	if cfg.IdleTimeout != Default().IdleTimeout {
+		t.Errorf("unset settings should keep their default: idle-timeout = %v", cfg.IdleTimeout)
+	}
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	for name, settings := range map[string]map[string]interface{}{
+		"array":   {"blocked-words": []string{"darn", "heck"}},
+		"object":  {"addr": map[string]string{"host": "localhost"}},
+		"null":    {"admin": nil},
+		"unknown": {"no-such-setting": "x"},
+		"invalid": {"max-links": "many"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("RTF_CONFIG", writeConfig(t, settings))
+			if _, err := Load(nil); err == nil {
+				t.Fatalf("loaded a config file with %v", settings)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	path := writeConfig(t, map[string]interface{}{})
+	t.Setenv("RTF_CONFIG", path)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+
+	cfg.CookieTTL = cfg.SessionTTL + time.Hour
+	cfg.PubSub = "nats://localhost"
+	cfg.BlocklistAction = "drop"
+	cfg.MaxLinks = -1
+
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{"cookie-ttl", "pubsub", "blocklist-action", "max-links"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+}
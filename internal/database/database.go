@@ -12,7 +12,9 @@ import (
 
 var DB *sql.DB
 
-func Initialize(dbPath string) error {
+var stopMonitor chan struct{}
+
+func Initialize(dbPath, schemaPath string) error {
 	var err error
 
 	_, err = os.Stat(dbPath)
@@ -31,30 +33,44 @@ func Initialize(dbPath string) error {
 		return fmt.Errorf("error connecting to database: %v", err)
 	}
 
-	go monitorDBConnection(dbPath)
-
-	if !dbExists {
-		schemaBytes, err := os.ReadFile("schema.sql")
-		if err != nil {
-			return fmt.Errorf("error reading schema file: %v", err)
-		}
+	stopMonitor = make(chan struct{})
+	go monitorDBConnection(dbPath, stopMonitor)
 
-		_, err = DB.Exec(string(schemaBytes))
-		if err != nil {
-			return fmt.Errorf("error creating database schema: %v", err)
-		}
+	if err = migrate(schemaPath); err != nil {
+		return err
+	}
 
+	if !dbExists {
 		fmt.Println("Database schema created successfully")
 	}
 
 	return nil
 }
 
-func monitorDBConnection(dbPath string) {
+// Close stops the connection monitor and closes the database.
+func Close() error {
+	if stopMonitor != nil {
+		close(stopMonitor)
+		stopMonitor = nil
+	}
+
+	if DB == nil {
+		return nil
+	}
+	return DB.Close()
+}
+
+func monitorDBConnection(dbPath string, stop <-chan struct{}) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
 		if err := DB.Ping(); err != nil {
 			log.Printf("Database connection error: %v, attempting to reconnect", err)
 
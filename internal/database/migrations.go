@@ -0,0 +1,133 @@
+package database
+
+import (
+	"fmt"
+	"os"
+)
+
+// column describes a column added to a table after it was first created.
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// addedColumns are applied to existing databases before schema.sql runs, so
+// that indexes in the schema may refer to them. Fresh databases get these
+// columns from the CREATE TABLE statements directly.
+var addedColumns = []column{
+	{"messages", "is_image", "BOOLEAN DEFAULT 0"},
+	{"users", "avatar", "TEXT"},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user'"},
+	{"users", "muted_until", "TIMESTAMP"},
+	{"users", "banned_at", "TIMESTAMP"},
+	{"users", "banned_until", "TIMESTAMP"},
+	{"users", "ban_reason", "TEXT"},
+	{"users", "presence", "TEXT NOT NULL DEFAULT 'online'"},
+	{"users", "last_seen_at", "TIMESTAMP"},
+	{"posts", "locked", "BOOLEAN DEFAULT 0"},
+	{"posts", "content_html", "TEXT"},
+	{"comments", "content_html", "TEXT"},
+	{"messages", "content_html", "TEXT"},
+	{"posts", "pinned", "TEXT NOT NULL DEFAULT ''"},
+	{"posts", "pinned_at", "TIMESTAMP"},
+	{"posts", "announcement", "BOOLEAN DEFAULT 0"},
+	{"posts", "publish_at", "TIMESTAMP"},
+}
+
+func migrate(schemaPath string) error {
+	for _, c := range addedColumns {
+		if err := ensureColumn(c); err != nil {
+			return err
+		}
+	}
+
+	categoriesExisted, err := tableExists("categories")
+	if err != nil {
+		return err
+	}
+
+	followsExisted, err := tableExists("follows")
+	if err != nil {
+		return err
+	}
+
+	schemaBytes, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return fmt.Errorf("error reading schema file: %v", err)
+	}
+
+	if _, err = DB.Exec(string(schemaBytes)); err != nil {
+		return fmt.Errorf("error applying database schema: %v", err)
+	}
+
+	if !categoriesExisted {
+		_, err = DB.Exec(`INSERT OR IGNORE INTO categories (name) VALUES
+			('general'), ('technology'), ('sports'), ('movies'), ('music')`)
+		if err != nil {
+			return fmt.Errorf("error seeding categories: %v", err)
+		}
+	}
+
+	// Authors and commenters follow the posts that existed before follows
+	// were tracked, as they would have had they been written afterwards.
+	if !followsExisted {
+		_, err = DB.Exec(`INSERT OR IGNORE INTO follows (user_id, target_type, target_id)
+			SELECT user_id, 'post', id FROM posts
+			UNION SELECT user_id, 'post', post_id FROM comments`)
+		if err != nil {
+			return fmt.Errorf("error seeding follows: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func tableExists(table string) (bool, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error checking table %s: %v", table, err)
+	}
+	return count > 0, nil
+}
+
+func ensureColumn(c column) error {
+	exists, err := tableExists(c.table)
+	if err != nil || !exists {
+		return err
+	}
+
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", c.table))
+	if err != nil {
+		return fmt.Errorf("error reading columns of %s: %v", c.table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    bool
+			defaultVal interface{}
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return fmt.Errorf("error reading columns of %s: %v", c.table, err)
+		}
+		if name == c.name {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading columns of %s: %v", c.table, err)
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.definition))
+	if err != nil {
+		return fmt.Errorf("error adding column %s.%s: %v", c.table, c.name, err)
+	}
+	return nil
+}
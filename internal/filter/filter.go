@@ -0,0 +1,162 @@
+// Package filter checks user-written text against the forum's content
+// policy before it is stored.
+package filter
+
+import (
+	"RTF/internal/config"
+	"strings"
+	"sync"
+)
+
+// Kinds of content passed through the pipeline.
+const (
+	KindPost    = "post"
+	KindComment = "comment"
+	KindMessage = "message"
+)
+
+// Content is a piece of text being checked and where it came from.
+type Content struct {
+	Kind   string
+	UserID int
+	Text   string
+}
+
+type Action string
+
+const (
+	Allow  Action = "allow"
+	Mask   Action = "mask"
+	Flag   Action = "flag"
+	Reject Action = "reject"
+)
+
+// Verdict is what one filter decided. Filters that mask rewrite the text
+// they are given.
+type Verdict struct {
+	Filter string `json:"filter"`
+	Action Action `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// A Filter is one stage of the pipeline. Check may change c.Text when it
+// masks; returning Reject stops the pipeline.
+type Filter interface {
+	Name() string
+	Check(c *Content) Verdict
+}
+
+// Result is the outcome of running the whole pipeline.
+type Result struct {
+	// Text is the text to store, after any masking.
+	Text     string
+	Rejected bool
+	// Reason explains a rejection to the author.
+	Reason string
+	// Verdicts lists every stage that did something other than allow.
+	Verdicts []Verdict
+}
+
+// Changed reports whether any filter acted on the content.
+func (r Result) Changed() bool {
+	return len(r.Verdicts) > 0
+}
+
+type Pipeline struct {
+	filters []Filter
+	// OnFiltered, when set, is called with every result that has verdicts
+	// so that they can be recorded.
+	OnFiltered func(original Content, result Result)
+}
+
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// Use appends a filter to the end of the pipeline.
+func (p *Pipeline) Use(f Filter) {
+	p.filters = append(p.filters, f)
+}
+
+func (p *Pipeline) Apply(c Content) Result {
+	original := c
+	result := Result{}
+
+	for _, f := range p.filters {
+		verdict := f.Check(&c)
+		if verdict.Action == Allow || verdict.Action == "" {
+			continue
+		}
+		if verdict.Filter == "" {
+			verdict.Filter = f.Name()
+		}
+		result.Verdicts = append(result.Verdicts, verdict)
+
+		if verdict.Action == Reject {
+			result.Rejected = true
+			result.Reason = verdict.Detail
+			break
+		}
+	}
+
+	result.Text = c.Text
+	if result.Rejected {
+		result.Text = ""
+	}
+
+	if result.Changed() && p.OnFiltered != nil {
+		p.OnFiltered(original, result)
+	}
+	return result
+}
+
+// FromConfig builds the standard pipeline: the blocklist, then the link
+// limit.
+func FromConfig(cfg *config.Config) *Pipeline {
+	p := NewPipeline()
+
+	var words []string
+	for _, word := range strings.Split(cfg.BlockedWords, ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	if len(words) > 0 {
+		action := Mask
+		if cfg.BlocklistAction == string(Reject) {
+			action = Reject
+		}
+		p.Use(NewBlocklist(words, action))
+	}
+
+	if cfg.MaxLinks > 0 {
+		p.Use(LinkLimit{Max: cfg.MaxLinks})
+	}
+
+	return p
+}
+
+var (
+	current      = NewPipeline()
+	currentMutex sync.RWMutex
+)
+
+// Set installs p as the pipeline used by Check. It is meant to be called
+// from main before the server starts, and again by tests.
+func Set(p *Pipeline) {
+	currentMutex.Lock()
+	current = p
+	currentMutex.Unlock()
+}
+
+// Get returns the pipeline installed by Set.
+func Get() *Pipeline {
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+	return current
+}
+
+// Check runs c through the installed pipeline.
+func Check(c Content) Result {
+	return Get().Apply(c)
+}
@@ -0,0 +1,108 @@
+package filter
+
+import (
+	"RTF/internal/config"
+	"testing"
+)
+
+func TestBlocklistMasksWholeWords(t *testing.T) {
+	p := NewPipeline(NewBlocklist([]string{"darn", "heck no"}, Mask))
+
+	result := p.Apply(Content{Kind: KindPost, Text: "Darn it, heck no! darned is fine"})
+	if result.Rejected {
+		t.Fatalf("masking blocklist rejected content: %s", result.Reason)
+	}
+	if want := "**** it, *******! darned is fine"; result.Text != want {
+		t.Fatalf("expected %q, got %q", want, result.Text)
+	}
+	if len(result.Verdicts) != 1 || result.Verdicts[0].Action != Mask || result.Verdicts[0].Filter != "blocklist" {
+		t.Fatalf("unexpected verdicts: %+v", result.Verdicts)
+	}
+}
+
+func TestBlocklistRejects(t *testing.T) {
+	p := NewPipeline(NewBlocklist([]string{"darn"}, Reject))
+
+	result := p.Apply(Content{Kind: KindComment, Text: "oh DARN"})
+	if !result.Rejected || result.Text != "" {
+		t.Fatalf("expected rejection, got %+v", result)
+	}
+
+	if result := p.Apply(Content{Kind: KindComment, Text: "all good"}); result.Changed() || result.Text != "all good" {
+		t.Fatalf("clean content changed: %+v", result)
+	}
+}
+
+func TestLinkLimit(t *testing.T) {
+	p := NewPipeline(LinkLimit{Max: 2})
+
+	if result := p.Apply(Content{Text: "see https://a.example and www.b.example"}); result.Rejected {
+		t.Fatalf("two links rejected: %s", result.Reason)
+	}
+	if result := p.Apply(Content{Text: "http://a.example http://b.example HTTPS://c.example"}); !result.Rejected {
+		t.Fatal("three links allowed")
+	}
+}
+
+type fixedScorer float64
+
+func (s fixedScorer) Score(Content) (float64, string) { return float64(s), "test" }
+
+func TestScoreFilterFlagsAndRejects(t *testing.T) {
+	check := func(score float64) Result {
+		return NewPipeline(ScoreFilter{Scorer: fixedScorer(score), FlagAt: 0.5, RejectAt: 0.9}).Apply(Content{Text: "buy now"})
+	}
+
+	if result := check(0.1); result.Changed() {
+		t.Fatalf("low score acted on: %+v", result.Verdicts)
+	}
+	if result := check(0.6); result.Rejected || len(result.Verdicts) != 1 || result.Verdicts[0].Action != Flag {
+		t.Fatalf("expected flag, got %+v", result)
+	}
+	if result := check(0.95); !result.Rejected {
+		t.Fatalf("expected rejection, got %+v", result)
+	}
+}
+
+func TestPipelineStopsAtRejectAndReports(t *testing.T) {
+	var recorded []Result
+	p := NewPipeline(NewBlocklist([]string{"darn"}, Mask), LinkLimit{Max: 0}, NewBlocklist([]string{"never"}, Reject))
+	p.OnFiltered = func(original Content, result Result) {
+		if original.Text != "darn http://x.example never" {
+			t.Errorf("hook got modified original %q", original.Text)
+		}
+		recorded = append(recorded, result)
+	}
+
+	result := p.Apply(Content{Text: "darn http://x.example never"})
+	if !result.Rejected || len(result.Verdicts) != 2 || result.Verdicts[1].Filter != "links" {
+		t.Fatalf("expected mask then link rejection, got %+v", result)
+	}
+	if len(recorded) != 1 {
+		t.Fatalf("expected one audit record, got %d", len(recorded))
+	}
+
+	p.Apply(Content{Text: "nothing to see"})
+	if len(recorded) != 1 {
+		t.Fatal("clean content was recorded")
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.BlockedWords = " darn , ,heck"
+	cfg.BlocklistAction = "reject"
+	cfg.MaxLinks = 1
+
+	p := FromConfig(cfg)
+	if len(p.filters) != 2 {
+		t.Fatalf("expected blocklist and link limit, got %d filters", len(p.filters))
+	}
+	if result := p.Apply(Content{Text: "heck"}); !result.Rejected {
+		t.Fatal("configured word not rejected")
+	}
+
+	if p := FromConfig(config.Default()); len(p.filters) != 1 {
+		t.Fatalf("default config should only limit links, got %d filters", len(p.filters))
+	}
+}
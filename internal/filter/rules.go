@@ -0,0 +1,96 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Blocklist masks or rejects whole-word, case-insensitive matches of a list
+// of words or phrases.
+type Blocklist struct {
+	pattern *regexp.Regexp
+	action  Action
+}
+
+// NewBlocklist builds a blocklist that applies action, Mask or Reject, to
+// any of words.
+func NewBlocklist(words []string, action Action) *Blocklist {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return &Blocklist{
+		pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`),
+		action:  action,
+	}
+}
+
+func (b *Blocklist) Name() string { return "blocklist" }
+
+func (b *Blocklist) Check(c *Content) Verdict {
+	matches := b.pattern.FindAllString(c.Text, -1)
+	if len(matches) == 0 {
+		return Verdict{Action: Allow}
+	}
+
+	if b.action == Reject {
+		return Verdict{Action: Reject, Detail: "contains blocked words"}
+	}
+
+	c.Text = b.pattern.ReplaceAllStringFunc(c.Text, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+	return Verdict{Action: Mask, Detail: fmt.Sprintf("masked %d blocked words", len(matches))}
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkLimit rejects text with more than Max links.
+type LinkLimit struct {
+	Max int
+}
+
+func (l LinkLimit) Name() string { return "links" }
+
+func (l LinkLimit) Check(c *Content) Verdict {
+	count := len(linkPattern.FindAllStringIndex(c.Text, -1))
+	if count <= l.Max {
+		return Verdict{Action: Allow}
+	}
+	return Verdict{Action: Reject, Detail: fmt.Sprintf("too many links (%d, at most %d allowed)", count, l.Max)}
+}
+
+// A Scorer rates how likely content is to be spam, from 0 to 1, and may
+// say why.
+type Scorer interface {
+	Score(c Content) (score float64, reason string)
+}
+
+// ScoreFilter adapts a Scorer to the pipeline: content scoring at least
+// RejectAt is rejected and content scoring at least FlagAt is kept but
+// flagged for review. A zero threshold disables that outcome.
+type ScoreFilter struct {
+	Scorer   Scorer
+	FlagAt   float64
+	RejectAt float64
+}
+
+func (s ScoreFilter) Name() string { return "spam_score" }
+
+func (s ScoreFilter) Check(c *Content) Verdict {
+	score, reason := s.Scorer.Score(*c)
+	detail := fmt.Sprintf("score %.2f", score)
+	if reason != "" {
+		detail += ": " + reason
+	}
+
+	switch {
+	case s.RejectAt > 0 && score >= s.RejectAt:
+		return Verdict{Action: Reject, Detail: "looks like spam (" + detail + ")"}
+	case s.FlagAt > 0 && score >= s.FlagAt:
+		return Verdict{Action: Flag, Detail: detail}
+	}
+	return Verdict{Action: Allow}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"RTF/internal/websocket"
+	"encoding/json"
+	"net/http"
+
+	gorillaWs "github.com/gorilla/websocket"
+)
+
+func UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !models.IsValidRole(request.Role) {
+		writeError(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	if err := models.SetUserRole(userID, request.Role); err != nil {
+		switch err {
+		case models.ErrNotFound:
+			writeError(w, http.StatusNotFound, "User not found")
+		case models.ErrLastAdmin:
+			writeError(w, http.StatusConflict, "Cannot demote the last admin")
+		default:
+			writeError(w, http.StatusInternalServerError, "Failed to update role")
+		}
+		return
+	}
+
+	logModeration(models.ModerationEntry{
+		ModeratorID: currentUser(r).ID,
+		Action:      models.ActionSetRole,
+		TargetType:  models.TargetUser,
+		TargetID:    userID,
+		Reason:      request.Role,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"userId": userID,
+		"role":   request.Role,
+	})
+}
+
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := models.DeleteUser(userID); err != nil {
+		switch err {
+		case models.ErrNotFound:
+			writeError(w, http.StatusNotFound, "User not found")
+		case models.ErrLastAdmin:
+			writeError(w, http.StatusConflict, "Cannot delete the last admin")
+		default:
+			writeError(w, http.StatusInternalServerError, "Failed to delete user")
+		}
+		return
+	}
+
+	websocket.DisconnectUser(userID, gorillaWs.CloseNormalClosure, "account deleted")
+	logModeration(models.ModerationEntry{
+		ModeratorID: currentUser(r).ID,
+		Action:      models.ActionDeleteUser,
+		TargetType:  models.TargetUser,
+		TargetID:    userID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "User deleted",
+	})
+}
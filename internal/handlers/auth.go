@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"RTF/internal/config"
 	"RTF/internal/models"
+	"RTF/internal/websocket"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -10,6 +13,8 @@ import (
 	"sync"
 	"time"
 	"unicode"
+
+	gorillaWs "github.com/gorilla/websocket"
 )
 
 var (
@@ -52,15 +57,10 @@ func isValidPassword(password string) (bool, string) {
 }
 
 func Register(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var user models.User
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Error reading request body")
 		return
 	}
 
@@ -71,7 +71,7 @@ func Register(w http.ResponseWriter, r *http.Request) {
 
 	err = json.Unmarshal(body, &tempUser)
 	if err != nil {
-		http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
 		return
 	}
 
@@ -80,24 +80,24 @@ func Register(w http.ResponseWriter, r *http.Request) {
 
 	if user.Nickname == "" || user.Age <= 0 || user.Gender == "" ||
 		user.FirstName == "" || user.LastName == "" || user.Email == "" || user.Password == "" {
-		http.Error(w, "All fields are required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "All fields are required")
 		return
 	}
 
 	if valid, message := isValidPassword(user.Password); !valid {
-		http.Error(w, message, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, message)
 		return
 	}
 
 	userID, err := models.CreateUser(user)
 	if err != nil {
-		http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to create user: "+err.Error())
 		return
 	}
 
 	session, err := models.CreateSession(userID)
 	if err != nil {
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
@@ -105,24 +105,25 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		Name:     "session_id",
 		Value:    session.ID,
 		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  time.Now().Add(config.Get().CookieTTL),
 		HttpOnly: true,
 	})
 
 	user.ID = userID
 	user.Password = ""
+	if created, err := models.GetUserByID(userID); err == nil {
+		user = created
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	response := map[string]interface{}{"user": user}
+	response := map[string]interface{}{
+		"user":        user,
+		"permissions": models.PermissionsForRole(user.Role),
+	}
 	json.NewEncoder(w).Encode(response)
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var credentials struct {
 		Login    string `json:"login"`
 		Password string `json:"password"`
@@ -130,13 +131,13 @@ func Login(w http.ResponseWriter, r *http.Request) {
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Error reading request body")
 		return
 	}
 
 	err = json.Unmarshal(body, &credentials)
 	if err != nil {
-		http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
 		return
 	}
 
@@ -145,23 +146,28 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	attempts := loginAttempts[ipAddr]
 	if attempts >= maxAttempts {
 		loginMutex.Unlock()
-		http.Error(w, "Too many failed attempts, please try again later", http.StatusTooManyRequests)
+		writeError(w, http.StatusTooManyRequests, "Too many failed attempts, please try again later")
 		return
 	}
 	loginMutex.Unlock()
 
 	user, err := models.AuthenticateUser(credentials.Login, credentials.Password)
+	var banned *models.BanError
+	if errors.As(err, &banned) {
+		writeError(w, http.StatusForbidden, "Your "+banned.Error())
+		return
+	}
 	if err != nil {
 		loginMutex.Lock()
 		loginAttempts[ipAddr]++
 		loginMutex.Unlock()
-		http.Error(w, "Authentication failed", http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, "Authentication failed")
 		return
 	}
 
 	session, err := models.CreateSession(user.ID)
 	if err != nil {
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
@@ -169,21 +175,19 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		Name:     "session_id",
 		Value:    session.ID,
 		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  time.Now().Add(config.Get().CookieTTL),
 		HttpOnly: true,
 	})
 
 	w.Header().Set("Content-Type", "application/json")
-	response := map[string]interface{}{"user": user}
+	response := map[string]interface{}{
+		"user":        user,
+		"permissions": models.PermissionsForRole(user.Role),
+	}
 	json.NewEncoder(w).Encode(response)
 }
 
 func Logout(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	cookie, err := r.Cookie("session_id")
 	if err != nil {
 		w.WriteHeader(http.StatusOK)
@@ -195,6 +199,12 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error deleting session: %v", err)
 	}
 
+	// Only the sockets opened with this session are closed, not those of
+	// the user's other logins.
+	if user, ok := UserFromContext(r.Context()); ok {
+		websocket.DisconnectSession(user.ID, cookie.Value, gorillaWs.CloseNormalClosure, "logged out")
+	}
+
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_id",
 		Value:    "",
@@ -209,42 +219,32 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 }
 
 func CheckSession(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		http.Error(w, "No session found", http.StatusUnauthorized)
-		return
-	}
-
-	user, err := models.GetUserBySessionID(cookie.Value)
-	if err != nil {
-		http.Error(w, "Invalid session", http.StatusUnauthorized)
-		return
-	}
+	user := currentUser(r)
+	cookie, _ := r.Cookie("session_id")
 
 	lastRotation, _ := strconv.ParseInt(r.URL.Query().Get("last_rotation"), 10, 64)
-	if lastRotation == 0 || time.Since(time.Unix(lastRotation, 0)) > 12*time.Hour {
+	if lastRotation == 0 || time.Since(time.Unix(lastRotation, 0)) > config.Get().SessionRotation {
 		if err := models.DeleteSession(cookie.Value); err != nil {
 			log.Printf("Error deleting old session: %v", err)
 		}
 
 		newSession, err := models.CreateSession(user.ID)
 		if err == nil {
+			websocket.RenameSession(user.ID, cookie.Value, newSession.ID)
 			http.SetCookie(w, &http.Cookie{
 				Name:     "session_id",
 				Value:    newSession.ID,
 				Path:     "/",
-				Expires:  time.Now().Add(24 * time.Hour),
+				Expires:  time.Now().Add(config.Get().CookieTTL),
 				HttpOnly: true,
 			})
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	response := map[string]interface{}{"user": user}
+	response := map[string]interface{}{
+		"user":        user,
+		"permissions": models.PermissionsForRole(user.Role),
+	}
 	json.NewEncoder(w).Encode(response)
 }
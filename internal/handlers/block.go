@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+func GetBlocks(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	blocks, err := models.GetUserBlocks(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get blocks")
+		return
+	}
+	if blocks == nil {
+		blocks = []models.UserBlock{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"blocks": blocks,
+	})
+}
+
+// BlockUser blocks or mutes another user, replacing any earlier choice.
+func BlockUser(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	userID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	request := struct {
+		Kind            string `json:"kind"`
+		CollapseContent *bool  `json:"collapseContent"`
+	}{Kind: models.BlockKindBlock}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	if !models.IsValidBlockKind(request.Kind) {
+		writeError(w, http.StatusBadRequest, `Kind must be "block" or "mute"`)
+		return
+	}
+	if userID == user.ID {
+		writeError(w, http.StatusBadRequest, "You cannot block yourself")
+		return
+	}
+
+	if _, err := models.GetUserByID(userID); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+
+	// Blocked users' posts are collapsed unless asked otherwise; muting
+	// never hides content.
+	block := models.UserBlock{
+		UserID:          user.ID,
+		BlockedID:       userID,
+		Kind:            request.Kind,
+		CollapseContent: request.Kind == models.BlockKindBlock,
+	}
+	if request.CollapseContent != nil && request.Kind == models.BlockKindBlock {
+		block.CollapseContent = *request.CollapseContent
+	}
+
+	if err := models.SetUserBlock(block); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to block user")
+		return
+	}
+
+	block, err := models.GetUserBlock(user.ID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get block")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"block": block,
+	})
+}
+
+func UnblockUser(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	userID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := models.RemoveUserBlock(user.ID, userID); err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "User is not blocked")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to unblock user")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "User unblocked",
+	})
+}
+
+// blockedUsers returns the users userID has blocked outright, and the
+// subset whose posts and comments should be collapsed. Errors are logged
+// and treated as no blocks so that listings still load.
+func blockedUsers(userID int) (hidden, collapsed map[int]bool) {
+	hidden = make(map[int]bool)
+	collapsed = make(map[int]bool)
+
+	blocks, err := models.GetBlocksByUser(userID)
+	if err != nil {
+		log.Printf("Failed to get blocks for user %d: %v", userID, err)
+		return hidden, collapsed
+	}
+
+	for id, b := range blocks {
+		if b.Kind != models.BlockKindBlock {
+			continue
+		}
+		hidden[id] = true
+		if b.CollapseContent {
+			collapsed[id] = true
+		}
+	}
+	return hidden, collapsed
+}
+
+func collapsePosts(posts []models.Post, collapsed map[int]bool) {
+	for i := range posts {
+		posts[i].Collapsed = collapsed[posts[i].UserID]
+	}
+}
+
+func collapseComments(comments []models.Comment, collapsed map[int]bool) {
+	for i := range comments {
+		comments[i].Collapsed = collapsed[comments[i].UserID]
+	}
+}
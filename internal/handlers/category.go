@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := models.GetAllCategories()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get categories")
+		return
+	}
+
+	followed, err := models.GetFollowedIDs(currentUser(r).ID, models.FollowCategory)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get followed categories")
+		return
+	}
+	for i := range categories {
+		categories[i].Following = followed[categories[i].ID]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"categories": categories,
+	})
+}
+
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	category.Name = strings.ToLower(strings.TrimSpace(category.Name))
+	if category.Name == "" {
+		writeError(w, http.StatusBadRequest, "Category name is required")
+		return
+	}
+
+	exists, err := models.CategoryExists(category.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create category")
+		return
+	}
+	if exists {
+		writeError(w, http.StatusConflict, "Category already exists")
+		return
+	}
+
+	category.ID, err = models.CreateCategory(category.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"category": category,
+	})
+}
+
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid category ID")
+		return
+	}
+
+	if err := models.DeleteCategory(categoryID); err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Category deleted",
+	})
+}
@@ -1,94 +1,110 @@
 package handlers
 
 import (
+	"RTF/internal/filter"
+	"RTF/internal/markup"
 	"RTF/internal/models"
 	"RTF/internal/websocket"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 )
 
-func HandleComments(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_id")
+func CreateComment(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var comment models.Comment
+	err := json.NewDecoder(r.Body).Decode(&comment)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if user.IsMuted() {
+		writeError(w, http.StatusForbidden, "You are muted and cannot comment")
+		return
+	}
+
+	post, err := models.GetPostByID(comment.PostID)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, http.StatusNotFound, "Post not found")
 		return
 	}
 
-	_, err = models.GetUserBySessionID(cookie.Value)
+	if post.Locked {
+		writeError(w, http.StatusForbidden, "Post is locked")
+		return
+	}
+
+	result := filter.Check(filter.Content{Kind: filter.KindComment, UserID: user.ID, Text: comment.Content})
+	if result.Rejected {
+		writeError(w, http.StatusBadRequest, "Comment rejected: "+result.Reason)
+		return
+	}
+	comment.Content = result.Text
+	comment.ContentHTML = markup.Render(comment.Content)
+
+	comment.UserID = user.ID
+
+	commentID, err := models.CreateComment(comment)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, http.StatusInternalServerError, "Failed to create comment")
 		return
 	}
 
-	switch r.Method {
-	case "POST":
-		var comment models.Comment
-		err = json.NewDecoder(r.Body).Decode(&comment)
-		if err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		user, err := models.GetUserBySessionID(cookie.Value)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		comment.UserID = user.ID
-
-		commentID, err := models.CreateComment(comment)
-		if err != nil {
-			http.Error(w, "Failed to create comment", http.StatusInternalServerError)
-			return
-		}
-
-		post, err := models.GetPostByID(comment.PostID)
-		if err != nil {
-			http.Error(w, "Failed to get post", http.StatusInternalServerError)
-			return
-		}
-
-		comment.ID = commentID
-		comment.Username = user.Nickname
-
-		websocket.Broadcast(websocket.Message{
-			Type: "new_comment",
-			Content: map[string]interface{}{
-				"comment": comment,
-				"postId":  post.ID,
-			},
-		})
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
+	comment.ID = commentID
+	comment.Username = user.Nickname
+	websocket.ClearDraft(user.ID, models.CommentDraft(post.ID))
+
+	if err := models.Follow(user.ID, models.FollowPost, post.ID); err != nil {
+		log.Printf("Failed to follow post %d for commenter %d: %v", post.ID, user.ID, err)
+	}
+
+	websocket.SendToPost(post.ID, websocket.Message{
+		Type: "new_comment",
+		Content: map[string]interface{}{
 			"comment": comment,
-		})
-	case "GET":
-		userIDStr := r.URL.Query().Get("userId")
-		if userIDStr == "" {
-			http.Error(w, "Missing userID parameter", http.StatusBadRequest)
-			return
-		}
-
-		userID, err := strconv.Atoi(userIDStr)
-		if err != nil {
-			http.Error(w, "Invalid userID", http.StatusBadRequest)
-			return
-		}
-
-		comments, err := models.GetCommentsByUserID(userID)
-		if err != nil {
-			http.Error(w, "Failed to get comments", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"comments": comments,
-		})
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			"postId":  post.ID,
+		},
+	})
+
+	mentioned := websocket.NotifyMentions(models.Mention{
+		AuthorID:   user.ID,
+		AuthorName: user.Nickname,
+		SourceType: models.TargetComment,
+		SourceID:   commentID,
+		PostID:     post.ID,
+	}, markup.Mentions(comment.Content), comment.Content)
+	websocket.NotifyNewComment(post, comment, user.Nickname, mentioned)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comment": comment,
+	})
+}
+
+func GetComments(w http.ResponseWriter, r *http.Request) {
+	userIDStr := r.URL.Query().Get("userId")
+	if userIDStr == "" {
+		writeError(w, http.StatusBadRequest, "Missing userID parameter")
+		return
+	}
+
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid userID")
+		return
+	}
+
+	comments, err := models.GetCommentsByUserID(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get comments")
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comments": comments,
+	})
 }
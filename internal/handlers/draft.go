@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"RTF/internal/websocket"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// maxDraftLength caps the size of a draft's content in bytes.
+const maxDraftLength = 20000
+
+// draftContext reads the context from the request path. It writes the
+// error response and returns false when the context is invalid.
+func draftContext(w http.ResponseWriter, r *http.Request) (string, bool) {
+	context := r.PathValue("context")
+	if !models.ValidDraftContext(context) {
+		writeError(w, http.StatusBadRequest, `Draft context must be "post", "comment:<postId>" or "chat:<userId>"`)
+		return "", false
+	}
+	return context, true
+}
+
+// GetDrafts lists the current user's drafts, most recently edited first.
+func GetDrafts(w http.ResponseWriter, r *http.Request) {
+	drafts, err := models.GetDrafts(currentUser(r).ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get drafts")
+		return
+	}
+	if drafts == nil {
+		drafts = []models.Draft{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"drafts": drafts,
+	})
+}
+
+func GetDraft(w http.ResponseWriter, r *http.Request) {
+	context, ok := draftContext(w, r)
+	if !ok {
+		return
+	}
+
+	draft, err := models.GetDraft(currentUser(r).ID, context)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Draft not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to get draft")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"draft": draft,
+	})
+}
+
+// SaveDraft autosaves the draft of a context from {title, category,
+// content} and syncs it to the user's other devices. Saving an empty draft
+// deletes it.
+func SaveDraft(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	context, ok := draftContext(w, r)
+	if !ok {
+		return
+	}
+
+	var draft models.Draft
+	if err := json.NewDecoder(r.Body).Decode(&draft); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	draft.Context = context
+	if context != models.DraftNewPost {
+		draft.Title = ""
+		draft.Category = ""
+	}
+
+	if len(draft.Title)+len(draft.Category)+len(draft.Content) > maxDraftLength {
+		writeError(w, http.StatusBadRequest, "Draft is too long")
+		return
+	}
+
+	if strings.TrimSpace(draft.Title) == "" && strings.TrimSpace(draft.Content) == "" {
+		websocket.ClearDraft(user.ID, context)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Draft deleted",
+		})
+		return
+	}
+
+	if err := models.SaveDraft(user.ID, draft); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save draft")
+		return
+	}
+
+	draft, err := models.GetDraft(user.ID, context)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get draft")
+		return
+	}
+	websocket.SendDraftUpdated(user.ID, draft)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"draft": draft,
+	})
+}
+
+func DeleteDraft(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	context, ok := draftContext(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteDraft(user.ID, context); err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Draft not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to delete draft")
+		return
+	}
+	websocket.SendDraftDeleted(user.ID, context)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Draft deleted",
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"RTF/internal/filter"
+	"RTF/internal/models"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// RecordFiltered stores what the content filter did so that moderators can
+// review it. It is installed as the pipeline's OnFiltered hook.
+func RecordFiltered(original filter.Content, result filter.Result) {
+	verdicts, err := json.Marshal(result.Verdicts)
+	if err != nil {
+		log.Printf("Failed to encode filter verdicts: %v", err)
+		return
+	}
+
+	entry := models.FilterLogEntry{
+		UserID:   original.UserID,
+		Kind:     original.Kind,
+		Action:   string(strongestAction(result)),
+		Original: original.Text,
+		Filtered: result.Text,
+		Verdicts: verdicts,
+	}
+	if err := models.LogFilterResult(entry); err != nil {
+		log.Printf("Failed to record filtered %s from user %d: %v", original.Kind, original.UserID, err)
+	}
+}
+
+func strongestAction(result filter.Result) filter.Action {
+	if result.Rejected {
+		return filter.Reject
+	}
+	action := filter.Flag
+	for _, v := range result.Verdicts {
+		if v.Action == filter.Mask {
+			action = filter.Mask
+		}
+	}
+	return action
+}
+
+func GetFilterLog(w http.ResponseWriter, r *http.Request) {
+	action := r.URL.Query().Get("action")
+	switch filter.Action(action) {
+	case "", filter.Mask, filter.Flag, filter.Reject:
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+
+	limit, offset := pageParams(r, 50)
+
+	entries, err := models.GetFilterLog(action, limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get filter log")
+		return
+	}
+	if entries == nil {
+		entries = []models.FilterLogEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	})
+}
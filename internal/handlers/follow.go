@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+func FollowPost(w http.ResponseWriter, r *http.Request) {
+	setFollow(w, r, models.FollowPost, true)
+}
+
+func UnfollowPost(w http.ResponseWriter, r *http.Request) {
+	setFollow(w, r, models.FollowPost, false)
+}
+
+func FollowCategory(w http.ResponseWriter, r *http.Request) {
+	setFollow(w, r, models.FollowCategory, true)
+}
+
+func UnfollowCategory(w http.ResponseWriter, r *http.Request) {
+	setFollow(w, r, models.FollowCategory, false)
+}
+
+// setFollow follows or unfollows the post or category named by the {id}
+// wildcard.
+func setFollow(w http.ResponseWriter, r *http.Request, targetType string, follow bool) {
+	user := currentUser(r)
+
+	id, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid "+targetType+" ID")
+		return
+	}
+
+	var err error
+	switch targetType {
+	case models.FollowPost:
+		_, err = models.GetPostByID(id)
+	case models.FollowCategory:
+		_, err = models.GetCategoryByID(id)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to load "+targetType)
+		return
+	}
+
+	message := "Following " + targetType
+	if follow {
+		err = models.Follow(user.ID, targetType, id)
+	} else {
+		err = models.Unfollow(user.ID, targetType, id)
+		message = "Unfollowed " + targetType
+	}
+	if err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Not following this "+targetType)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to update follow")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   message,
+		"following": follow,
+	})
+}
+
+// GetFollowingFeed lists the posts and categories the current user follows
+// with what is new in each since their last visit.
+func GetFollowingFeed(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	posts, err := models.GetFollowedPosts(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get followed posts")
+		return
+	}
+	if posts == nil {
+		posts = []models.FollowedPost{}
+	}
+
+	categories, err := models.GetFollowedCategories(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get followed categories")
+		return
+	}
+	if categories == nil {
+		categories = []models.FollowedCategory{}
+	}
+
+	_, collapsed := blockedUsers(user.ID)
+	for i := range posts {
+		posts[i].Collapsed = collapsed[posts[i].UserID]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts":      posts,
+		"categories": categories,
+	})
+}
+
+// markVisited records a visit to a followed post or category. Failures are
+// only logged: they cost the user an unread marker, not the page.
+func markVisited(userID int, targetType string, targetID int) {
+	if err := models.MarkVisited(userID, targetType, targetID); err != nil {
+		log.Printf("Failed to record visit of user %d to %s %d: %v", userID, targetType, targetID, err)
+	}
+}
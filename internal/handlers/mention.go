@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"encoding/json"
+	"net/http"
+)
+
+// GetMentions lists the current user's mentions, newest first. With
+// ?unread=true only unread mentions are returned.
+func GetMentions(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	limit, offset := pageParams(r, 20)
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	mentions, err := models.GetMentions(user.ID, unreadOnly, limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get mentions")
+		return
+	}
+	if mentions == nil {
+		mentions = []models.Mention{}
+	}
+
+	unread, err := models.CountUnreadMentions(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to count mentions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mentions":    mentions,
+		"unreadCount": unread,
+	})
+}
+
+// MarkMentionsRead marks the mentions listed in {"ids": [...]} as read, or
+// all of them when no IDs are given.
+func MarkMentionsRead(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var request struct {
+		IDs []int `json:"ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	if err := models.MarkMentionsRead(user.ID, request.IDs); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to mark mentions as read")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Mentions marked as read",
+	})
+}
@@ -9,36 +9,37 @@ import (
 )
 
 func GetMessages(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	user, err := models.GetUserBySessionID(cookie.Value)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	user := currentUser(r)
 
 	otherUserID, err := strconv.Atoi(r.URL.Query().Get("user"))
 	if err != nil || otherUserID == 0 {
 		conversations, err := models.GetLastMessageWithEachUser(user.ID)
 		if err != nil {
-			http.Error(w, "Failed to get conversations", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to get conversations")
 			return
 		}
 
+		hidden, _ := blockedUsers(user.ID)
+		visible := conversations[:0]
+		for _, msg := range conversations {
+			otherID := msg.SenderID
+			if otherID == user.ID {
+				otherID = msg.ReceiverID
+			}
+			if !hidden[otherID] {
+				visible = append(visible, msg)
+			}
+		}
+		conversations = visible
+
 		unreadCounts, err := models.GetUnreadMessageCount(user.ID)
 		if err != nil {
-			http.Error(w, "Failed to get unread counts", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to get unread counts")
 			return
 		}
+		for id := range hidden {
+			delete(unreadCounts, id)
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -63,7 +64,7 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 
 	messages, err := models.GetMessagesBetweenUsers(user.ID, otherUserID, limit, offset)
 	if err != nil {
-		http.Error(w, "Failed to get messages", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to get messages")
 		return
 	}
 
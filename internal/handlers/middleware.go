@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"context"
+	"net/http"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the user stored by RequireAuth or OptionalAuth.
+func UserFromContext(ctx context.Context) (models.User, bool) {
+	user, ok := ctx.Value(userContextKey).(models.User)
+	return user, ok
+}
+
+// currentUser is for handlers wrapped in RequireAuth, where the user is
+// always present.
+func currentUser(r *http.Request) models.User {
+	user, _ := UserFromContext(r.Context())
+	return user
+}
+
+func userFromSession(r *http.Request) (models.User, bool) {
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		return models.User{}, false
+	}
+
+	user, err := models.GetUserBySessionID(cookie.Value)
+	if err != nil {
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// RequireAuth rejects requests without a valid session and otherwise passes
+// the session user to next through the request context.
+func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := userFromSession(r)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next(w, r.WithContext(WithUser(r.Context(), user)))
+	}
+}
+
+// OptionalAuth adds the session user to the request context when there is
+// one, and calls next either way.
+func OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := userFromSession(r); ok {
+			r = r.WithContext(WithUser(r.Context(), user))
+		}
+
+		next(w, r)
+	}
+}
+
+// RequirePermission behaves like RequireAuth and additionally requires the
+// user's role to grant the given permission.
+func RequirePermission(permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser(r).Can(permission) {
+			writeError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		next(w, r)
+	})
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"RTF/internal/websocket"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	gorillaWs "github.com/gorilla/websocket"
+)
+
+func LockPost(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	var request struct {
+		Locked bool `json:"locked"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := models.SetPostLocked(postID, request.Locked); err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+
+	action := models.ActionUnlockPost
+	if request.Locked {
+		action = models.ActionLockPost
+	}
+	logModeration(models.ModerationEntry{
+		ModeratorID: currentUser(r).ID,
+		Action:      action,
+		TargetType:  models.TargetPost,
+		TargetID:    postID,
+	})
+
+	websocket.Broadcast(websocket.Message{
+		Type: "post_locked",
+		Content: map[string]interface{}{
+			"postId": postID,
+			"locked": request.Locked,
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"postId": postID,
+		"locked": request.Locked,
+	})
+}
+
+// PinPost pins a post to the top of every feed or of its category's, or
+// unpins it when pinned is empty.
+func PinPost(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	var request struct {
+		Pinned string `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	switch request.Pinned {
+	case "", models.PinGlobal, models.PinCategory:
+	default:
+		writeError(w, http.StatusBadRequest, `Pinned must be "global", "category" or empty`)
+		return
+	}
+
+	if err := models.SetPostPinned(postID, request.Pinned); err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+
+	action := models.ActionUnpinPost
+	if request.Pinned != "" {
+		action = models.ActionPinPost
+	}
+	logModeration(models.ModerationEntry{
+		ModeratorID: currentUser(r).ID,
+		Action:      action,
+		TargetType:  models.TargetPost,
+		TargetID:    postID,
+		Reason:      request.Pinned,
+	})
+
+	broadcastPinned(w, postID)
+}
+
+// SetAnnouncement marks a post as a site-wide announcement or clears the
+// mark.
+func SetAnnouncement(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	var request struct {
+		Announcement bool `json:"announcement"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := models.SetPostAnnouncement(postID, request.Announcement); err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to update post")
+		return
+	}
+
+	action := models.ActionUnannounce
+	if request.Announcement {
+		action = models.ActionAnnounce
+	}
+	logModeration(models.ModerationEntry{
+		ModeratorID: currentUser(r).ID,
+		Action:      action,
+		TargetType:  models.TargetPost,
+		TargetID:    postID,
+	})
+
+	broadcastPinned(w, postID)
+}
+
+// broadcastPinned tells everyone where a post now sits in the listings and
+// answers the request with the same state.
+func broadcastPinned(w http.ResponseWriter, postID int) {
+	post, err := models.GetPostByID(postID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load post")
+		return
+	}
+
+	state := map[string]interface{}{
+		"postId":       post.ID,
+		"category":     post.Category,
+		"pinned":       post.Pinned,
+		"announcement": post.Announcement,
+	}
+	websocket.Broadcast(websocket.Message{
+		Type:    "post_pinned",
+		Content: state,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+func MuteUser(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	userID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var request struct {
+		Minutes int `json:"minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if request.Minutes < 0 {
+		writeError(w, http.StatusBadRequest, "Minutes cannot be negative")
+		return
+	}
+
+	target, err := models.GetUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+
+	if target.ID == user.ID || (target.Role != models.RoleUser && !user.Can(models.PermManageRoles)) {
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	// Zero minutes lifts an existing mute.
+	var until *time.Time
+	if request.Minutes > 0 {
+		t := time.Now().Add(time.Duration(request.Minutes) * time.Minute)
+		until = &t
+	}
+
+	if err := models.MuteUser(target.ID, until); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to mute user")
+		return
+	}
+
+	entry := models.ModerationEntry{
+		ModeratorID: user.ID,
+		Action:      models.ActionUnmute,
+		TargetType:  models.TargetUser,
+		TargetID:    target.ID,
+	}
+	if until != nil {
+		entry.Action = models.ActionMute
+		entry.Reason = fmt.Sprintf("%d minutes", request.Minutes)
+	}
+	logModeration(entry)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"userId":     target.ID,
+		"mutedUntil": until,
+	})
+}
+
+// BanUser bans a user for the given number of minutes, or permanently when
+// minutes is zero, and signs them out everywhere.
+func BanUser(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	userID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var request struct {
+		Minutes int    `json:"minutes"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+
+	if len(request.Reason) > maxBanReasonLength {
+		writeError(w, http.StatusBadRequest, "Ban reasons are limited to 100 characters")
+		return
+	}
+
+	if request.Minutes < 0 {
+		writeError(w, http.StatusBadRequest, "Minutes cannot be negative")
+		return
+	}
+
+	target, err := models.GetUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+
+	if target.ID == user.ID || (target.Role != models.RoleUser && !user.Can(models.PermManageRoles)) {
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	var until *time.Time
+	if request.Minutes > 0 {
+		t := time.Now().Add(time.Duration(request.Minutes) * time.Minute)
+		until = &t
+	}
+
+	if err := models.BanUser(target.ID, until, request.Reason); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to ban user")
+		return
+	}
+	closeBanned(target.ID, request.Reason)
+
+	logModeration(models.ModerationEntry{
+		ModeratorID: user.ID,
+		Action:      models.ActionBan,
+		TargetType:  models.TargetUser,
+		TargetID:    target.ID,
+		Reason:      request.Reason,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"userId":      target.ID,
+		"bannedUntil": until,
+		"reason":      request.Reason,
+	})
+}
+
+func UnbanUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := models.UnbanUser(userID); err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to unban user")
+		return
+	}
+
+	logModeration(models.ModerationEntry{
+		ModeratorID: currentUser(r).ID,
+		Action:      models.ActionUnban,
+		TargetType:  models.TargetUser,
+		TargetID:    userID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"userId": userID,
+		"banned": false,
+	})
+}
+
+// maxBanReasonLength keeps "banned: " and the reason within the 123 bytes a
+// close frame has for its text, so the client sees the whole reason.
+const maxBanReasonLength = 100
+
+// closeBanned closes a banned user's websockets with a policy violation
+// frame whose reason starts with "banned", which the client shows instead
+// of reconnecting.
+func closeBanned(userID int, reason string) {
+	text := "banned"
+	if reason != "" {
+		text += ": " + reason
+	}
+	websocket.DisconnectUser(userID, gorillaWs.ClosePolicyViolation, text)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"encoding/json"
+	"net/http"
+)
+
+// GetNotifications lists the current user's notifications, newest first,
+// with their unread counts in total and by type. With ?unread=true only
+// unread notifications are listed.
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	limit, offset := pageParams(r, 20)
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, err := models.GetNotifications(user.ID, unreadOnly, limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get notifications")
+		return
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+
+	counts, err := models.UnreadNotificationCounts(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to count notifications")
+		return
+	}
+	unread := 0
+	for _, count := range counts {
+		unread += count
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"unreadCount":   unread,
+		"unreadByType":  counts,
+	})
+}
+
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	id, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	if err := models.MarkNotificationRead(user.ID, id); err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Notification not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to mark notification as read")
+		return
+	}
+
+	writeUnreadNotifications(w, user.ID, "Notification marked as read")
+}
+
+func MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	if err := models.MarkAllNotificationsRead(user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to mark notifications as read")
+		return
+	}
+
+	writeUnreadNotifications(w, user.ID, "Notifications marked as read")
+}
+
+// writeUnreadNotifications confirms a read marker with the remaining unread
+// count, so that the client can update its badge.
+func writeUnreadNotifications(w http.ResponseWriter, userID int, message string) {
+	unread, err := models.CountUnreadNotifications(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to count notifications")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     message,
+		"unreadCount": unread,
+	})
+}
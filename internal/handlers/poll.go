@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"RTF/internal/filter"
+	"RTF/internal/models"
+	"RTF/internal/websocket"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 10
+	maxPollOptionLength = 100
+)
+
+// preparePoll checks a poll sent along with a new post and fills in its
+// defaults. It returns a message for the client when the poll is invalid.
+func preparePoll(poll *models.Poll, userID int) string {
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return fmt.Sprintf("A poll needs between %d and %d options", minPollOptions, maxPollOptions)
+	}
+
+	seen := make(map[string]bool)
+	options := make([]models.PollOption, 0, len(poll.Options))
+	for _, option := range poll.Options {
+		text := strings.TrimSpace(option.Text)
+		if text == "" || len(text) > maxPollOptionLength {
+			return fmt.Sprintf("Poll options must be between 1 and %d characters", maxPollOptionLength)
+		}
+
+		result := filter.Check(filter.Content{Kind: filter.KindPost, UserID: userID, Text: text})
+		if result.Rejected {
+			return "Poll rejected: " + result.Reason
+		}
+		text = result.Text
+
+		key := strings.ToLower(text)
+		if seen[key] {
+			return "Poll options must be different"
+		}
+		seen[key] = true
+		options = append(options, models.PollOption{Text: text})
+	}
+	poll.Options = options
+
+	if !poll.Multiple {
+		poll.MaxChoices = 1
+	} else if poll.MaxChoices == 0 {
+		poll.MaxChoices = len(options)
+	}
+	if poll.MaxChoices < 1 || poll.MaxChoices > len(options) {
+		return "Max choices must be between 1 and the number of options"
+	}
+
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		return "Poll close time must be in the future"
+	}
+	return ""
+}
+
+// VotePoll records the current user's choices in a post's poll from
+// {"optionIds": [...]}, replacing any earlier vote. An empty list withdraws
+// the vote. Everyone viewing the post gets the new results.
+func VotePoll(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	postID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	var request struct {
+		OptionIDs []int `json:"optionIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// The post must be published: scheduled ones take no votes yet.
+	if _, err := models.GetPostByID(postID); err != nil {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	poll, err := models.GetPollByPostID(postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Poll not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to load poll")
+		return
+	}
+
+	if err := models.Vote(poll, user.ID, request.OptionIDs); err != nil {
+		switch err {
+		case models.ErrPollClosed:
+			writeError(w, http.StatusForbidden, "Poll is closed")
+		case models.ErrTooManyChoices:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("At most %d options can be chosen", poll.MaxChoices))
+		case models.ErrInvalidChoice, models.ErrDuplicateChoice:
+			writeError(w, http.StatusBadRequest, "Invalid poll option")
+		default:
+			writeError(w, http.StatusInternalServerError, "Failed to record vote")
+		}
+		return
+	}
+
+	poll, err = models.GetPollByPostID(postID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load poll")
+		return
+	}
+
+	websocket.SendToPost(postID, websocket.Message{
+		Type: "poll_results",
+		Content: map[string]interface{}{
+			"postId": postID,
+			"poll":   poll,
+		},
+	})
+
+	// The broadcast results are shared; the voter's own choices go on a
+	// copy.
+	mine := *poll
+	setMyVotes(&mine, user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"poll": mine,
+	})
+}
+
+func setMyVotes(poll *models.Poll, userID int) {
+	votes, err := models.GetPollVotes(poll.ID, userID)
+	if err != nil {
+		log.Printf("Failed to load votes of user %d in poll %d: %v", userID, poll.ID, err)
+		return
+	}
+	poll.MyVotes = votes
+}
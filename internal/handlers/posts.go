@@ -1,107 +1,209 @@
 package handlers
 
 import (
+	"RTF/internal/filter"
+	"RTF/internal/markup"
 	"RTF/internal/models"
+	"RTF/internal/websocket"
+	"database/sql"
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
-	"strconv"
 	"strings"
+	"time"
 )
 
-func HandlePosts(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_id")
+// GetPosts lists all posts, or with ?category= the posts of one category.
+// With ?after=<RFC 3339 time> it instead returns the posts created since
+// then, oldest first, for clients catching up after a disconnect. The
+// response names the websocket topic that delivers further new posts.
+func GetPosts(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var after time.Time
+	if value := r.URL.Query().Get("after"); value != "" {
+		var err error
+		if after, err = time.Parse(time.RFC3339, value); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid after time, expected RFC 3339")
+			return
+		}
+	}
+
+	var categoryName string
+	topic := websocket.FeedTopic
+	if name := r.URL.Query().Get("category"); name != "" {
+		category, err := models.GetCategoryByName(name)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				writeError(w, http.StatusNotFound, "Category not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "Failed to fetch posts")
+			return
+		}
+		categoryName = category.Name
+		topic = websocket.CategoryTopic(category.ID)
+		markVisited(user.ID, models.FollowCategory, category.ID)
+	}
+
+	var posts []models.Post
+	var err error
+	switch {
+	case !after.IsZero():
+		limit, _ := pageParams(r, 50)
+		posts, err = models.GetPostsSince(after, categoryName, limit)
+	case categoryName != "":
+		posts, err = models.GetPostsByCategory(categoryName)
+	default:
+		posts, err = models.GetAllPosts()
+	}
 	if err != nil {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		writeError(w, http.StatusInternalServerError, "Failed to fetch posts")
 		return
 	}
 
-	user, err := models.GetUserBySessionID(cookie.Value)
+	_, collapsed := blockedUsers(user.ID)
+	collapsePosts(posts, collapsed)
+
+	unread, err := models.UnreadCommentCounts(user.ID)
 	if err != nil {
-		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		log.Printf("Failed to count unread comments for user %d: %v", user.ID, err)
+	}
+	for i := range posts {
+		posts[i].UnreadComments = unread[posts[i].ID]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{
+		"posts": posts,
+		"topic": topic,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func CreatePost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Error reading request body")
 		return
 	}
 
-	switch r.Method {
-	case "GET":
-		posts, err := models.GetAllPosts()
-		if err != nil {
-			http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
-			return
-		}
+	var post models.Post
+	err = json.Unmarshal(body, &post)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON format: "+err.Error())
+		return
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		response := map[string]interface{}{"posts": posts}
-		json.NewEncoder(w).Encode(response)
+	post.Title = strings.TrimSpace(post.Title)
+	post.Content = strings.TrimSpace(post.Content)
+	post.Category = strings.TrimSpace(post.Category)
 
-	case "POST":
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "Error reading request body", http.StatusBadRequest)
+	if post.Title == "" || post.Content == "" || post.Category == "" {
+		writeError(w, http.StatusBadRequest, "Title, content, and category are required (cannot be empty or just whitespace)")
+		return
+	}
+
+	if user.IsMuted() {
+		writeError(w, http.StatusForbidden, "You are muted and cannot create posts")
+		return
+	}
+
+	for _, field := range []*string{&post.Title, &post.Content} {
+		result := filter.Check(filter.Content{Kind: filter.KindPost, UserID: user.ID, Text: *field})
+		if result.Rejected {
+			writeError(w, http.StatusBadRequest, "Post rejected: "+result.Reason)
 			return
 		}
+		*field = result.Text
+	}
 
-		var post models.Post
-		err = json.Unmarshal(body, &post)
-		if err != nil {
-			http.Error(w, "Invalid JSON format: "+err.Error(), http.StatusBadRequest)
+	if post.Poll != nil {
+		if msg := preparePoll(post.Poll, user.ID); msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
 			return
 		}
+	}
 
-		post.Title = strings.TrimSpace(post.Title)
-		post.Content = strings.TrimSpace(post.Content)
-		post.Category = strings.TrimSpace(post.Category)
+	if msg := checkPublishAt(post); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
 
-		if post.Title == "" || post.Content == "" || post.Category == "" {
-			http.Error(w, "Title, content, and category are required (cannot be empty or just whitespace)", http.StatusBadRequest)
+	if _, err := models.GetCategoryByName(post.Category); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusBadRequest, "Unknown category")
 			return
 		}
+		writeError(w, http.StatusInternalServerError, "Failed to validate category")
+		return
+	}
 
-		post.UserID = user.ID
+	post.UserID = user.ID
+	// Always render here: a contentHtml sent by the client is never trusted.
+	post.ContentHTML = markup.Render(post.Content)
 
-		postID, err := models.CreatePost(post)
-		if err != nil {
-			http.Error(w, "Failed to create post: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+	postID, err := models.CreatePost(post)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create post: "+err.Error())
+		return
+	}
 
-		comments, err := models.GetCommentsByPostID(postID)
-		if err != nil {
-			comments = []models.Comment{}
-		}
+	websocket.ClearDraft(user.ID, models.DraftNewPost)
 
-		post.ID = postID
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"post":     post,
-			"comments": comments,
-		})
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if err := models.Follow(user.ID, models.FollowPost, postID); err != nil {
+		log.Printf("Failed to follow post %d for its author: %v", postID, err)
 	}
-}
 
-func HandlePostDetail(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// Reload the post so the response and the broadcast carry what was
+	// stored, author included, rather than what the client sent.
+	scheduled := post.PublishAt != nil
+	if scheduled {
+		post, err = models.GetScheduledPost(postID, user.ID)
+	} else {
+		post, err = models.GetPostByID(postID)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to load created post")
 		return
 	}
 
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 3 {
-		http.Error(w, "Invalid post ID", http.StatusBadRequest)
-		return
+	// Scheduled posts are announced by the scheduler once they are due.
+	if !scheduled {
+		websocket.PostPublished(post)
 	}
 
-	postID, err := strconv.Atoi(parts[len(parts)-1])
+	comments, err := models.GetCommentsByPostID(postID)
 	if err != nil {
-		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		comments = []models.Comment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"post":     post,
+		"comments": comments,
+	})
+}
+
+func GetPost(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid post ID")
 		return
 	}
 
+	user := currentUser(r)
+
 	post, err := models.GetPostByID(postID)
 	if err != nil {
-		http.Error(w, "Post not found", http.StatusNotFound)
+		// Authors can preview their scheduled posts.
+		post, err = models.GetScheduledPost(postID, user.ID)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Post not found")
 		return
 	}
 
@@ -110,9 +212,105 @@ func HandlePostDetail(w http.ResponseWriter, r *http.Request) {
 		comments = []models.Comment{}
 	}
 
+	_, collapsed := blockedUsers(user.ID)
+	post.Collapsed = collapsed[post.UserID]
+	collapseComments(comments, collapsed)
+
+	if post.Poll != nil {
+		setMyVotes(post.Poll, user.ID)
+	}
+
+	following, err := models.IsFollowing(user.ID, models.FollowPost, post.ID)
+	if err != nil {
+		log.Printf("Failed to check follow of post %d by user %d: %v", post.ID, user.ID, err)
+	}
+	markVisited(user.ID, models.FollowPost, post.ID)
+
+	firstUnread, lastComment := unreadComments(&post, comments, user.ID)
+	if lastComment > 0 {
+		if err := models.MarkPostRead(user.ID, post.ID, lastComment); err != nil {
+			log.Printf("Failed to mark post %d read for user %d: %v", post.ID, user.ID, err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"post":     post,
-		"comments": comments,
+		"post":                 post,
+		"comments":             comments,
+		"following":            following,
+		"firstUnreadCommentId": firstUnread,
+	})
+}
+
+// unreadComments counts the comments by others userID has not read yet and
+// sets post.UnreadComments. It returns the first of them, or 0 when there is
+// none, and the newest comment ID, which becomes the new read marker.
+func unreadComments(post *models.Post, comments []models.Comment, userID int) (firstUnread, lastComment int) {
+	lastRead, err := models.GetLastReadComment(userID, post.ID)
+	if err != nil {
+		log.Printf("Failed to load read marker of post %d for user %d: %v", post.ID, userID, err)
+		return 0, 0
+	}
+
+	for _, comment := range comments {
+		if comment.ID > lastComment {
+			lastComment = comment.ID
+		}
+		if comment.ID <= lastRead || comment.UserID == userID {
+			continue
+		}
+		post.UnreadComments++
+		if firstUnread == 0 || comment.ID < firstUnread {
+			firstUnread = comment.ID
+		}
+	}
+	return firstUnread, lastComment
+}
+
+// DeletePost removes a post on behalf of its author or a moderator.
+func DeletePost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	postID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	post, err := models.GetPostByID(postID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	if post.UserID != user.ID && !user.Can(models.PermDeleteAnyPost) {
+		writeError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if err := models.DeletePost(post.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete post")
+		return
+	}
+
+	websocket.SendToPost(post.ID, websocket.Message{
+		Type: "post_deleted",
+		Content: map[string]interface{}{
+			"postId": post.ID,
+		},
+	})
+
+	if post.UserID != user.ID {
+		logModeration(models.ModerationEntry{
+			ModeratorID: user.ID,
+			Action:      models.ActionDeleteContent,
+			TargetType:  models.TargetPost,
+			TargetID:    post.ID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Post deleted",
 	})
 }
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"RTF/internal/models"
+	"RTF/internal/websocket"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxReportReasonLength = 500
+
+// CreateReport files a report about a post, comment, message or user.
+func CreateReport(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var request struct {
+		TargetType string `json:"targetType"`
+		TargetID   int    `json:"targetId"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	request.Reason = strings.TrimSpace(request.Reason)
+	if !models.IsValidReportTarget(request.TargetType) || request.TargetID <= 0 {
+		writeError(w, http.StatusBadRequest, "Invalid report target")
+		return
+	}
+	if request.Reason == "" || len(request.Reason) > maxReportReasonLength {
+		writeError(w, http.StatusBadRequest, "A reason of at most 500 characters is required")
+		return
+	}
+
+	authorID, err := models.ContentAuthor(request.TargetType, request.TargetID)
+	if err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Reported content not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to find reported content")
+		return
+	}
+
+	if authorID == user.ID {
+		writeError(w, http.StatusBadRequest, "You cannot report yourself")
+		return
+	}
+
+	// Private messages can only be reported by the people in the
+	// conversation.
+	if request.TargetType == models.TargetMessage {
+		message, err := models.GetMessageByID(request.TargetID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to find reported content")
+			return
+		}
+		if message.ReceiverID != user.ID {
+			writeError(w, http.StatusNotFound, "Reported content not found")
+			return
+		}
+	}
+
+	report := models.Report{
+		ReporterID:   user.ID,
+		TargetType:   request.TargetType,
+		TargetID:     request.TargetID,
+		TargetUserID: authorID,
+		Reason:       request.Reason,
+		Status:       models.ReportOpen,
+		CreatedAt:    time.Now(),
+	}
+	report.ID, err = models.CreateReport(report)
+	if err != nil {
+		if err == models.ErrDuplicateReport {
+			writeError(w, http.StatusConflict, "You have already reported this")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to create report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"report": report,
+	})
+}
+
+// GetReports lists the moderation queue, open reports by default.
+func GetReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ReportOpen
+	}
+	if !models.IsValidReportStatus(status) {
+		writeError(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	limit, offset := pageParams(r, 50)
+
+	reports, err := models.GetReports(status, limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get reports")
+		return
+	}
+	if reports == nil {
+		reports = []models.Report{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reports": reports,
+	})
+}
+
+// ResolveReport closes a report, optionally acting on it: deleting the
+// reported content, warning its author or banning them for a while.
+func ResolveReport(w http.ResponseWriter, r *http.Request) {
+	moderator := currentUser(r)
+
+	reportID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+
+	var request struct {
+		Action  string `json:"action"`
+		Reason  string `json:"reason"`
+		Minutes int    `json:"minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	request.Reason = strings.TrimSpace(request.Reason)
+
+	report, err := models.GetReportByID(reportID)
+	if err != nil {
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusNotFound, "Report not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to get report")
+		return
+	}
+	if report.Status != models.ReportOpen {
+		writeError(w, http.StatusConflict, "Report already resolved")
+		return
+	}
+
+	entry := models.ModerationEntry{
+		ModeratorID: moderator.ID,
+		TargetType:  report.TargetType,
+		TargetID:    report.TargetID,
+		ReportID:    &report.ID,
+		Reason:      request.Reason,
+	}
+	status := models.ReportActioned
+
+	// act carries out the chosen action once the report is claimed, so that
+	// moderators racing on the same report cannot both act on it.
+	var act func() error
+
+	switch request.Action {
+	case "dismiss":
+		entry.Action = models.ActionDismissReport
+		status = models.ReportDismissed
+
+	case "delete":
+		if report.TargetType == models.TargetUser {
+			writeError(w, http.StatusBadRequest, "Users cannot be deleted from the report queue")
+			return
+		}
+		act = func() error {
+			if err := deleteReportedContent(report); err != nil && err != models.ErrNotFound {
+				return err
+			}
+			return nil
+		}
+		entry.Action = models.ActionDeleteContent
+
+	case "warn":
+		if report.TargetUserID == 0 {
+			writeError(w, http.StatusConflict, "Reported user no longer exists")
+			return
+		}
+		act = func() error {
+			websocket.NotifyWarning(report.TargetUserID, moderator, report.ID, request.Reason)
+			return nil
+		}
+		entry.Action = models.ActionWarn
+		entry.TargetType = models.TargetUser
+		entry.TargetID = report.TargetUserID
+
+	case "ban":
+		if !moderator.Can(models.PermBanUser) {
+			writeError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		if request.Minutes <= 0 {
+			writeError(w, http.StatusBadRequest, "Minutes must be positive")
+			return
+		}
+		if len(request.Reason) > maxBanReasonLength {
+			writeError(w, http.StatusBadRequest, "Ban reasons are limited to 100 characters")
+			return
+		}
+		target, err := models.GetUserByID(report.TargetUserID)
+		if err != nil {
+			writeError(w, http.StatusConflict, "Reported user no longer exists")
+			return
+		}
+		if target.Role != models.RoleUser && !moderator.Can(models.PermManageRoles) {
+			writeError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+		act = func() error {
+			until := time.Now().Add(time.Duration(request.Minutes) * time.Minute)
+			if err := models.BanUser(target.ID, &until, request.Reason); err != nil {
+				return err
+			}
+			closeBanned(target.ID, request.Reason)
+			return nil
+		}
+		entry.Action = models.ActionBan
+		entry.TargetType = models.TargetUser
+		entry.TargetID = target.ID
+
+	default:
+		writeError(w, http.StatusBadRequest, `Action must be "dismiss", "delete", "warn" or "ban"`)
+		return
+	}
+
+	closed, err := models.ResolveReport(report, status, moderator.ID)
+	if err != nil {
+		if err == models.ErrReportClosed {
+			writeError(w, http.StatusConflict, "Report already resolved")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to resolve report")
+		return
+	}
+
+	if act != nil {
+		if err := act(); err != nil {
+			log.Printf("Failed to %s for report %d: %v", request.Action, report.ID, err)
+			writeError(w, http.StatusInternalServerError, "Report resolved but the action failed")
+			return
+		}
+	}
+
+	logModeration(entry)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reportId": report.ID,
+		"status":   status,
+		"action":   entry.Action,
+		"resolved": closed,
+	})
+}
+
+func GetModerationLog(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r, 50)
+
+	entries, err := models.GetModerationLog(limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to get moderation log")
+		return
+	}
+	if entries == nil {
+		entries = []models.ModerationEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	})
+}
+
+// deleteReportedContent removes a reported post, comment or message and
+// tells the clients that are showing it.
+func deleteReportedContent(report models.Report) error {
+	switch report.TargetType {
+	case models.TargetPost:
+		if err := models.DeletePost(report.TargetID); err != nil {
+			return err
+		}
+		websocket.SendToPost(report.TargetID, websocket.Message{
+			Type: "post_deleted",
+			Content: map[string]interface{}{
+				"postId": report.TargetID,
+			},
+		})
+
+	case models.TargetComment:
+		postID, err := models.DeleteComment(report.TargetID)
+		if err != nil {
+			return err
+		}
+		websocket.SendToPost(postID, websocket.Message{
+			Type: "comment_deleted",
+			Content: map[string]interface{}{
+				"postId":    postID,
+				"commentId": report.TargetID,
+			},
+		})
+
+	case models.TargetMessage:
+		message, err := models.GetMessageByID(report.TargetID)
+		if err != nil {
+			return models.ErrNotFound
+		}
+		if err := models.DeleteMessage(message.ID); err != nil {
+			return err
+		}
+		websocket.Send(websocket.ToConversation(message.SenderID, message.ReceiverID), websocket.Message{
+			Type: "message_deleted",
+			Content: map[string]interface{}{
+				"messageId": message.ID,
+			},
+		})
+	}
+	return nil
+}
+
+// logModeration records a moderation action. The action itself has already
+// happened, so a failure is only logged.
+func logModeration(entry models.ModerationEntry) {
+	if err := models.LogModeration(entry); err != nil {
+		log.Printf("Failed to record moderation action %s on %s %d: %v", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
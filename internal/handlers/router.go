@@ -0,0 +1,58 @@
+package handlers
+
+import "net/http"
+
+// Router wraps http.ServeMux so that requests the mux itself rejects (no
+// matching route or wrong method) get the same JSON error envelope as
+// handler errors.
+type Router struct {
+	mux *http.ServeMux
+}
+
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+func (rt *Router) Handle(pattern string, handler http.Handler) {
+	rt.mux.Handle(pattern, handler)
+}
+
+func (rt *Router) HandleFunc(pattern string, handler http.HandlerFunc) {
+	rt.mux.HandleFunc(pattern, handler)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, pattern := rt.mux.Handler(r)
+	if pattern == "" {
+		handler.ServeHTTP(&envelopeWriter{ResponseWriter: w}, r)
+		return
+	}
+
+	rt.mux.ServeHTTP(w, r)
+}
+
+// NotFound replies with a JSON 404 for unknown API paths, which would
+// otherwise fall through to the SPA's index page.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "Not found")
+}
+
+// envelopeWriter replaces the plain-text body that ServeMux writes for
+// unmatched requests with the JSON error envelope. Headers such as Allow are
+// kept.
+type envelopeWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (e *envelopeWriter) WriteHeader(status int) {
+	if e.wroteHeader {
+		return
+	}
+	e.wroteHeader = true
+	writeError(e.ResponseWriter, status, http.StatusText(status))
+}
+
+func (e *envelopeWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"RTF/internal/filter"
+	"RTF/internal/markup"
+	"RTF/internal/models"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkPublishAt validates the publish time of a post being scheduled. It
+// returns a message for the client when the time is not acceptable.
+func checkPublishAt(post models.Post) string {
+	if post.PublishAt == nil {
+		return ""
+	}
+	if !post.PublishAt.After(time.Now()) {
+		return "Publish time must be in the future"
+	}
+	if post.Poll != nil && post.Poll.ClosesAt != nil && !post.Poll.ClosesAt.After(*post.PublishAt) {
+		return "Poll close time must be after the publish time"
+	}
+	return ""
+}
+
+// GetScheduledPosts lists the current user's scheduled posts, the next one
+// due first.
+func GetScheduledPosts(w http.ResponseWriter, r *http.Request) {
+	posts, err := models.GetScheduledPosts(currentUser(r).ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to fetch scheduled posts")
+		return
+	}
+	if posts == nil {
+		posts = []models.Post{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"posts": posts,
+	})
+}
+
+// UpdateScheduledPost replaces the title, content, category and publish
+// time of one of the current user's scheduled posts.
+func UpdateScheduledPost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	postID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	existing, err := models.GetScheduledPost(postID, user.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Scheduled post not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to fetch scheduled post")
+		return
+	}
+
+	var post models.Post
+	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	post.Title = strings.TrimSpace(post.Title)
+	post.Content = strings.TrimSpace(post.Content)
+	post.Category = strings.TrimSpace(post.Category)
+
+	if post.Title == "" || post.Content == "" || post.Category == "" || post.PublishAt == nil {
+		writeError(w, http.StatusBadRequest, "Title, content, category and publish time are required")
+		return
+	}
+
+	if user.IsMuted() {
+		writeError(w, http.StatusForbidden, "You are muted and cannot edit posts")
+		return
+	}
+
+	for _, field := range []*string{&post.Title, &post.Content} {
+		result := filter.Check(filter.Content{Kind: filter.KindPost, UserID: user.ID, Text: *field})
+		if result.Rejected {
+			writeError(w, http.StatusBadRequest, "Post rejected: "+result.Reason)
+			return
+		}
+		*field = result.Text
+	}
+
+	post.Poll = existing.Poll
+	if msg := checkPublishAt(post); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if _, err := models.GetCategoryByName(post.Category); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusBadRequest, "Unknown category")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to validate category")
+		return
+	}
+
+	post.ID = postID
+	post.UserID = user.ID
+	post.ContentHTML = markup.Render(post.Content)
+
+	if err := models.UpdateScheduledPost(post); err != nil {
+		// The scheduler may have published it in the meantime.
+		if err == models.ErrNotFound {
+			writeError(w, http.StatusConflict, "Post is already published")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to update scheduled post")
+		return
+	}
+
+	updated, err := models.GetScheduledPost(postID, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to fetch scheduled post")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"post": updated,
+	})
+}
+
+// CancelScheduledPost deletes one of the current user's scheduled posts
+// before it is published.
+func CancelScheduledPost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	postID, ok := pathID(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	if _, err := models.GetScheduledPost(postID, user.ID); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "Scheduled post not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Failed to fetch scheduled post")
+		return
+	}
+
+	if err := models.DeletePost(postID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to cancel scheduled post")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Scheduled post cancelled",
+	})
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"RTF/internal/config"
 	"RTF/internal/models"
 	"RTF/internal/websocket"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,48 +14,38 @@ import (
 )
 
 func GetUsers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	_, err = models.GetUserBySessionID(cookie.Value)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	users, err := models.GetAllUsers()
 	if err != nil {
-		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to get users")
 		return
 	}
 
-	onlineUserIDs := websocket.GetOnlineUsers()
-
-	onlineMap := make(map[int]bool)
-	for _, id := range onlineUserIDs {
-		onlineMap[id] = true
-	}
+	statuses := websocket.GetPresence()
+	hidden, _ := blockedUsers(currentUser(r).ID)
 
 	var usersWithStatus []map[string]interface{}
 	for _, user := range users {
+		if hidden[user.ID] {
+			continue
+		}
+
+		status, online := statuses[user.ID]
+		if !online {
+			status = "offline"
+		}
+
 		userData := map[string]interface{}{
-			"id":        user.ID,
-			"nickname":  user.Nickname,
-			"age":       user.Age,
-			"gender":    user.Gender,
-			"firstName": user.FirstName,
-			"lastName":  user.LastName,
-			"email":     user.Email,
-			"createdAt": user.CreatedAt,
-			"isOnline":  onlineMap[user.ID],
+			"id":         user.ID,
+			"nickname":   user.Nickname,
+			"age":        user.Age,
+			"gender":     user.Gender,
+			"firstName":  user.FirstName,
+			"lastName":   user.LastName,
+			"email":      user.Email,
+			"createdAt":  user.CreatedAt,
+			"isOnline":   online,
+			"status":     status,
+			"lastSeenAt": user.LastSeenAt,
 		}
 		usersWithStatus = append(usersWithStatus, userData)
 	}
@@ -64,69 +56,93 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func GetOnlineUsers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// LookupUsers backs @mention autocompletion: it returns the users whose
+// nickname starts with ?prefix=, leaving out the caller and the users they
+// blocked.
+func LookupUsers(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
 
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	prefix := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("prefix")), "@")
+	if prefix == "" {
+		writeError(w, http.StatusBadRequest, "prefix is required")
 		return
 	}
+	limit, _ := pageParams(r, 10)
 
-	_, err = models.GetUserBySessionID(cookie.Value)
+	users, err := models.LookupNicknames(prefix, limit)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, http.StatusInternalServerError, "Failed to look up users")
 		return
 	}
 
-	onlineUserIDs := websocket.GetOnlineUsers()
+	hidden, _ := blockedUsers(user.ID)
+	matches := []map[string]interface{}{}
+	for _, u := range users {
+		if hidden[u.ID] || u.ID == user.ID {
+			continue
+		}
+		matches = append(matches, map[string]interface{}{
+			"id":       u.ID,
+			"nickname": u.Nickname,
+		})
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"onlineUsers": onlineUserIDs,
+		"users": matches,
 	})
 }
-func HandleUserAvatar(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+// GetOnlineUsers lists who is online, leaving out the users the caller
+// blocked as GetUsers does.
+func GetOnlineUsers(w http.ResponseWriter, r *http.Request) {
+	statuses := websocket.GetPresence()
+	hidden, _ := blockedUsers(currentUser(r).ID)
+	for id := range hidden {
+		delete(statuses, id)
 	}
 
-	user, err := models.GetUserBySessionID(cookie.Value)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+	onlineUserIDs := make([]int, 0, len(statuses))
+	for id := range statuses {
+		onlineUserIDs = append(onlineUserIDs, id)
 	}
 
-	err = r.ParseMultipartForm(10 << 20)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"onlineUsers": onlineUserIDs,
+		"statuses":    statuses,
+	})
+}
+
+func HandleUserAvatar(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, config.Get().MaxUploadSize)
+	err := r.ParseMultipartForm(config.Get().MaxUploadSize)
 	if err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "Failed to parse form")
 		return
 	}
 
 	file, handler, err := r.FormFile("avatar")
 	if err != nil {
-		http.Error(w, "Failed to get file", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Failed to get file")
 		return
 	}
 	defer file.Close()
 
 	contentType := handler.Header.Get("Content-Type")
 	if !strings.HasPrefix(contentType, "image/") {
-		http.Error(w, "File must be an image", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "File must be an image")
 		return
 	}
 
-	uploadDir := "./static/uploads/avatars"
+	uploadDir := config.Get().UploadDir
 	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
 		os.MkdirAll(uploadDir, 0755)
 	}
@@ -136,20 +152,20 @@ func HandleUserAvatar(w http.ResponseWriter, r *http.Request) {
 
 	dst, err := os.Create(filepath)
 	if err != nil {
-		http.Error(w, "Failed to create file", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to create file")
 		return
 	}
 	defer dst.Close()
 
 	_, err = io.Copy(dst, file)
 	if err != nil {
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to save file")
 		return
 	}
 
 	err = models.UpdateUserAvatar(user.ID, filename)
 	if err != nil {
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
 
@@ -18,27 +18,23 @@ var upgrader = gorillaWs.Upgrader{
 }
 
 func ServeWs(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_id")
-	if err != nil {
-		log.Printf("Unauthorized WebSocket connection attempt: %v", err)
-		http.Error(w, "Unauthorized: No session cookie found", http.StatusUnauthorized)
-		return
-	}
+	user := currentUser(r)
 
-	user, err := models.GetUserBySessionID(cookie.Value)
-	if err != nil {
-		log.Printf("Unauthorized WebSocket connection attempt with invalid session: %v", err)
-		http.Error(w, "Unauthorized: Invalid session", http.StatusUnauthorized)
+	// RequireAuth already turns banned users away; this covers a ban issued
+	// between the session lookup and the upgrade.
+	if fresh, err := models.GetUserByID(user.ID); err == nil && fresh.IsBanned() {
+		writeError(w, http.StatusForbidden, "Account is banned")
 		return
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection to WebSocket for user %d: %v", user.ID, err)
-		http.Error(w, "Could not establish WebSocket connection", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Could not establish WebSocket connection")
 		return
 	}
 
 	log.Printf("WebSocket connection established for user %d from %s", user.ID, r.RemoteAddr)
-	ws.HandleConnections(conn, user.ID)
+	cookie, _ := r.Cookie("session_id")
+	ws.HandleConnections(conn, user.ID, cookie.Value)
 }
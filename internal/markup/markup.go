@@ -0,0 +1,207 @@
+// Package markup renders the Markdown subset accepted in posts, comments
+// and messages to HTML.
+//
+// The renderer never copies input through as markup: all text is escaped
+// and the only tags produced are those in AllowedTags. Links are the only
+// elements with attributes: an href limited to http, https and mailto URLs
+// or relative paths, plus fixed rel and target values. The output is
+// therefore safe to insert into a page as-is.
+package markup
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// AllowedTags lists every element Render can produce.
+var AllowedTags = []string{
+	"p", "br", "strong", "em", "del", "code", "pre", "blockquote",
+	"ul", "ol", "li", "a", "h3", "h4", "h5", "h6", "hr",
+}
+
+// Render converts Markdown source to sanitized HTML.
+func Render(source string) string {
+	lines := strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n")
+	var out strings.Builder
+	renderBlocks(&out, lines)
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	bulletPattern    = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedPattern   = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	rulePattern      = regexp.MustCompile(`^\s{0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	quotePattern     = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	fencePattern     = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	blankLinePattern = regexp.MustCompile(`^\s*$`)
+)
+
+func renderBlocks(out *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		switch {
+		case blankLinePattern.MatchString(line):
+			i++
+
+		case fencePattern.MatchString(line):
+			fence := fencePattern.FindStringSubmatch(line)[1]
+			i++
+			var code []string
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // closing fence, or past the end
+			out.WriteString("<pre><code>")
+			out.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			out.WriteString("</code></pre>\n")
+
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			// Headings start at h3 so that content never outranks the
+			// page's own titles.
+			level := len(m[1]) + 2
+			if level > 6 {
+				level = 6
+			}
+			tag := "h" + string(rune('0'+level))
+			out.WriteString("<" + tag + ">" + renderInline(m[2]) + "</" + tag + ">\n")
+			i++
+
+		case rulePattern.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+
+		case quotePattern.MatchString(line):
+			var quoted []string
+			for i < len(lines) && quotePattern.MatchString(lines[i]) {
+				quoted = append(quoted, quotePattern.FindStringSubmatch(lines[i])[1])
+				i++
+			}
+			out.WriteString("<blockquote>\n")
+			renderBlocks(out, quoted)
+			out.WriteString("</blockquote>\n")
+
+		case bulletPattern.MatchString(line):
+			i = renderList(out, lines, i, bulletPattern, "ul")
+
+		case orderedPattern.MatchString(line):
+			i = renderList(out, lines, i, orderedPattern, "ol")
+
+		default:
+			var paragraph []string
+			for i < len(lines) && !startsBlock(lines[i]) {
+				paragraph = append(paragraph, strings.TrimSpace(lines[i]))
+				i++
+			}
+			rendered := make([]string, len(paragraph))
+			for j, l := range paragraph {
+				rendered[j] = renderInline(l)
+			}
+			out.WriteString("<p>" + strings.Join(rendered, "<br>\n") + "</p>\n")
+		}
+	}
+}
+
+func startsBlock(line string) bool {
+	return blankLinePattern.MatchString(line) ||
+		fencePattern.MatchString(line) ||
+		headingPattern.MatchString(line) ||
+		rulePattern.MatchString(line) ||
+		quotePattern.MatchString(line) ||
+		bulletPattern.MatchString(line) ||
+		orderedPattern.MatchString(line)
+}
+
+// renderList writes the list starting at lines[i] and returns the index of
+// the first line after it. Items are single lines; nesting is not supported.
+func renderList(out *strings.Builder, lines []string, i int, item *regexp.Regexp, tag string) int {
+	out.WriteString("<" + tag + ">\n")
+	for i < len(lines) && item.MatchString(lines[i]) {
+		out.WriteString("<li>" + renderInline(item.FindStringSubmatch(lines[i])[1]) + "</li>\n")
+		i++
+	}
+	out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+var (
+	codeSpanPattern = regexp.MustCompile("`([^`]+)`")
+	linkPattern     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	autoLinkPattern = regexp.MustCompile(`https?://[^\s<>"')\]]+`)
+	strongPattern   = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	emPattern       = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+	delPattern      = regexp.MustCompile(`~~([^~]+)~~`)
+)
+
+// renderInline handles code spans, links and emphasis within one line.
+// Code spans and links are cut out first so that their contents are not
+// treated as emphasis.
+func renderInline(text string) string {
+	// NUL delimits the placeholders below and has no business in text.
+	text = strings.ReplaceAll(text, "\x00", "")
+
+	var pieces []string
+	placeholder := func(rendered string) string {
+		pieces = append(pieces, rendered)
+		return "\x00" + string(rune(len(pieces)-1+0xE000)) + "\x00"
+	}
+
+	text = codeSpanPattern.ReplaceAllStringFunc(text, func(m string) string {
+		return placeholder("<code>" + html.EscapeString(codeSpanPattern.FindStringSubmatch(m)[1]) + "</code>")
+	})
+	text = linkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+		href, ok := safeURL(parts[2])
+		if !ok {
+			return placeholder(html.EscapeString(parts[1]))
+		}
+		return placeholder(anchor(href, emphasis(html.EscapeString(parts[1]))))
+	})
+	text = autoLinkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		trimmed := strings.TrimRight(m, ".,;:!?")
+		rest := m[len(trimmed):]
+		return placeholder(anchor(trimmed, html.EscapeString(trimmed))) + rest
+	})
+
+	text = emphasis(html.EscapeString(text))
+
+	// A piece can hold earlier ones, such as a code span in a link label,
+	// so later pieces go back first.
+	for i := len(pieces) - 1; i >= 0; i-- {
+		text = strings.Replace(text, "\x00"+string(rune(i+0xE000))+"\x00", pieces[i], 1)
+	}
+	return text
+}
+
+// emphasis applies bold, italic and strikethrough to already escaped text.
+func emphasis(escaped string) string {
+	escaped = strongPattern.ReplaceAllStringFunc(escaped, func(m string) string {
+		parts := strongPattern.FindStringSubmatch(m)
+		return "<strong>" + parts[1] + parts[2] + "</strong>"
+	})
+	escaped = emPattern.ReplaceAllStringFunc(escaped, func(m string) string {
+		parts := emPattern.FindStringSubmatch(m)
+		return "<em>" + parts[1] + parts[2] + "</em>"
+	})
+	return delPattern.ReplaceAllString(escaped, "<del>$1</del>")
+}
+
+func anchor(href, label string) string {
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">` + label + `</a>`
+}
+
+// safeURL accepts http, https and mailto URLs and relative paths, and
+// rejects everything else, such as javascript: and data: URLs.
+func safeURL(raw string) (string, bool) {
+	lower := strings.ToLower(strings.TrimSpace(raw))
+	for _, prefix := range []string{"http://", "https://", "mailto:", "/"} {
+		if strings.HasPrefix(lower, prefix) && !strings.HasPrefix(lower, "//") {
+			return strings.TrimSpace(raw), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,84 @@
+package markup
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>"},
+		{"emphasis", "**bold** *it* _it_ ~~gone~~ snake_case_name", "<p><strong>bold</strong> <em>it</em> <em>it</em> <del>gone</del> snake_case_name</p>"},
+		{"code span", "use `<b>*x*</b>`", "<p>use <code>&lt;b&gt;*x*&lt;/b&gt;</code></p>"},
+		{"fenced code", "```\n<script>\n**no**\n```", "<pre><code>&lt;script&gt;\n**no**</code></pre>"},
+		{"heading", "# Title", "<h3>Title</h3>"},
+		{"lists", "- a\n- b\n\n1. c", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n<ol>\n<li>c</li>\n</ol>"},
+		{"quote", "> quoted *text*", "<blockquote>\n<p>quoted <em>text</em></p>\n</blockquote>"},
+		{"rule", "---", "<hr>"},
+		{"link", "[site](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer" target="_blank">site</a></p>`},
+		{"code in link", "[use `x`](https://a.example)", `<p><a href="https://a.example" rel="nofollow noopener noreferrer" target="_blank">use <code>x</code></a></p>`},
+		{"emphasis in link", "[**bold** *it*](https://a.example)", `<p><a href="https://a.example" rel="nofollow noopener noreferrer" target="_blank"><strong>bold</strong> <em>it</em></a></p>`},
+		{"autolink", "see https://example.com.", `<p>see <a href="https://example.com" rel="nofollow noopener noreferrer" target="_blank">https://example.com</a>.</p>`},
+		{"arithmetic", "2 * 3 * 4", "<p>2 * 3 * 4</p>"},
+	}
+
+	for _, tt := range tests {
+		if got := Render(tt.source); got != tt.want {
+			t.Errorf("%s: Render(%q)\n got  %q\n want %q", tt.name, tt.source, got, tt.want)
+		}
+	}
+}
+
+var tagPattern = regexp.MustCompile(`<(/?)([a-zA-Z0-9]+)([^>]*)>`)
+
+func TestRenderOnlyProducesAllowedMarkup(t *testing.T) {
+	allowed := make(map[string]bool)
+	for _, tag := range AllowedTags {
+		allowed[tag] = true
+	}
+
+	attacks := []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`[click](JaVaScRiPt:alert(1))`,
+		`[click](data:text/html;base64,PHNjcmlwdD4=)`,
+		`[click](//evil.example)`,
+		`[x](https://a.example/"onmouseover="alert(1))`,
+		`https://a.example/"><script>alert(1)</script>`,
+		"**<b onclick=x>**",
+		"> <iframe src=x>",
+		"- <svg/onload=alert(1)>",
+		"# <style>body{}</style>",
+		"\x00\x00 <script>",
+	}
+
+	for _, source := range attacks {
+		out := Render(source)
+		for _, m := range tagPattern.FindAllStringSubmatch(out, -1) {
+			tag, attrs := strings.ToLower(m[2]), m[3]
+			if !allowed[tag] {
+				t.Errorf("Render(%q) produced <%s>: %s", source, tag, out)
+			}
+			if attrs != "" && !(tag == "a" && m[1] == "" && strings.HasPrefix(attrs, ` href="http`)) {
+				t.Errorf("Render(%q) produced attributes %q on <%s>: %s", source, attrs, tag, out)
+			}
+		}
+		if strings.Contains(strings.ToLower(out), "javascript:") || strings.Contains(out, "<script") {
+			t.Errorf("Render(%q) let a script through: %s", source, out)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	source := "hi @alice and @Bob_2, cc @alice. mail me@example.com or `@code`\n```\n@fenced\n```\n(@carol.) @"
+	want := []string{"alice", "Bob_2", "carol"}
+
+	got := Mentions(source)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("Mentions(%q) = %q, want %q", source, got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package markup
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mentionPattern matches @nickname where the @ does not follow a word
+// character, so that e-mail addresses are not taken for mentions.
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@([\p{L}\p{N}_.\-]+)`)
+
+// Mentions returns the nicknames mentioned with @nickname in source, in
+// order of first appearance and without duplicates. Code spans and fenced
+// code are ignored. Nicknames are compared case-insensitively.
+func Mentions(source string) []string {
+	source = stripCode(source)
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(source, -1) {
+		name := strings.TrimRight(m[2], ".-")
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// stripCode blanks out fenced code blocks and code spans.
+func stripCode(source string) string {
+	lines := strings.Split(source, "\n")
+	var kept []string
+	fence := ""
+	for _, line := range lines {
+		if m := fencePattern.FindStringSubmatch(line); m != nil && (fence == "" || m[1] == fence) {
+			if fence == "" {
+				fence = m[1]
+			} else {
+				fence = ""
+			}
+			continue
+		}
+		if fence == "" {
+			kept = append(kept, codeSpanPattern.ReplaceAllString(line, " "))
+		}
+	}
+	return strings.Join(kept, "\n")
+}
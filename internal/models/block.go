@@ -0,0 +1,118 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"time"
+)
+
+// A block hides a user and stops them from contacting the blocker; a mute
+// only silences notifications about them.
+const (
+	BlockKindBlock = "block"
+	BlockKindMute  = "mute"
+)
+
+type UserBlock struct {
+	UserID          int       `json:"userId"`
+	BlockedID       int       `json:"blockedId"`
+	Nickname        string    `json:"nickname,omitempty"`
+	Kind            string    `json:"kind"`
+	CollapseContent bool      `json:"collapseContent"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+func IsValidBlockKind(kind string) bool {
+	return kind == BlockKindBlock || kind == BlockKindMute
+}
+
+// SetUserBlock creates or replaces the block userID holds on b.BlockedID.
+func SetUserBlock(b UserBlock) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO user_blocks (user_id, blocked_id, kind, collapse_content) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, blocked_id) DO UPDATE SET kind = excluded.kind, collapse_content = excluded.collapse_content
+	`, b.UserID, b.BlockedID, b.Kind, b.CollapseContent)
+	return err
+}
+
+func RemoveUserBlock(userID, blockedID int) error {
+	result, err := database.DB.Exec("DELETE FROM user_blocks WHERE user_id = ? AND blocked_id = ?", userID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func GetUserBlocks(userID int) ([]UserBlock, error) {
+	rows, err := database.DB.Query(`
+		SELECT b.user_id, b.blocked_id, u.nickname, b.kind, b.collapse_content, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.user_id = ?
+		ORDER BY u.nickname
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []UserBlock
+	for rows.Next() {
+		var b UserBlock
+		if err := rows.Scan(&b.UserID, &b.BlockedID, &b.Nickname, &b.Kind, &b.CollapseContent, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+func GetUserBlock(userID, blockedID int) (UserBlock, error) {
+	var b UserBlock
+	err := database.DB.QueryRow(`
+		SELECT b.user_id, b.blocked_id, u.nickname, b.kind, b.collapse_content, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.user_id = ? AND b.blocked_id = ?
+	`, userID, blockedID).Scan(&b.UserID, &b.BlockedID, &b.Nickname, &b.Kind, &b.CollapseContent, &b.CreatedAt)
+	return b, err
+}
+
+// GetBlocksByUser returns userID's blocks and mutes keyed by the other user.
+func GetBlocksByUser(userID int) (map[int]UserBlock, error) {
+	blocks, err := GetUserBlocks(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[int]UserBlock, len(blocks))
+	for _, b := range blocks {
+		byUser[b.BlockedID] = b
+	}
+	return byUser, nil
+}
+
+// IsBlockedBetween reports whether either user has blocked the other.
+// Mutes do not count.
+func IsBlockedBetween(userID, otherID int) (bool, error) {
+	var count int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*) FROM user_blocks
+		WHERE kind = ? AND ((user_id = ? AND blocked_id = ?) OR (user_id = ? AND blocked_id = ?))
+	`, BlockKindBlock, userID, otherID, otherID, userID).Scan(&count)
+	return count > 0, err
+}
+
+// HasMuted reports whether userID silenced notifications about otherID.
+func HasMuted(userID, otherID int) (bool, error) {
+	var count int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(*) FROM user_blocks WHERE user_id = ? AND blocked_id = ? AND kind = ?",
+		userID, otherID, BlockKindMute,
+	).Scan(&count)
+	return count > 0, err
+}
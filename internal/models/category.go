@@ -0,0 +1,82 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"time"
+)
+
+type Category struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Following is set per viewer.
+	Following bool `json:"following"`
+}
+
+func GetAllCategories() ([]Category, error) {
+	rows, err := database.DB.Query("SELECT id, name, created_at FROM categories ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		var category Category
+		err := rows.Scan(&category.ID, &category.Name, &category.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, nil
+}
+
+func CategoryExists(name string) (bool, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM categories WHERE name = ?", name).Scan(&count)
+	return count > 0, err
+}
+
+func GetCategoryByID(id int) (Category, error) {
+	var category Category
+	err := database.DB.QueryRow("SELECT id, name, created_at FROM categories WHERE id = ?", id).
+		Scan(&category.ID, &category.Name, &category.CreatedAt)
+	return category, err
+}
+
+func GetCategoryByName(name string) (Category, error) {
+	var category Category
+	err := database.DB.QueryRow("SELECT id, name, created_at FROM categories WHERE name = ?", name).
+		Scan(&category.ID, &category.Name, &category.CreatedAt)
+	return category, err
+}
+
+func CreateCategory(name string) (int, error) {
+	result, err := database.DB.Exec("INSERT INTO categories (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func DeleteCategory(id int) error {
+	result, err := database.DB.Exec("DELETE FROM categories WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	_, err = database.DB.Exec("DELETE FROM follows WHERE target_type = ? AND target_id = ?", FollowCategory, id)
+	return err
+}
@@ -2,22 +2,31 @@ package models
 
 import (
 	"RTF/internal/database"
+	"RTF/internal/markup"
+	"database/sql"
 	"time"
 )
 
 type Comment struct {
-	ID        int       `json:"id"`
-	PostID    int       `json:"postId"`
-	UserID    int       `json:"userId"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"createdAt"`
-	Username  string    `json:"username,omitempty"`
+	ID          int       `json:"id"`
+	PostID      int       `json:"postId"`
+	UserID      int       `json:"userId"`
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"contentHtml"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Username    string    `json:"username,omitempty"`
+	// Collapsed is set per viewer when they blocked the author.
+	Collapsed bool `json:"collapsed,omitempty"`
 }
 
 func CreateComment(comment Comment) (int, error) {
+	if comment.ContentHTML == "" {
+		comment.ContentHTML = markup.Render(comment.Content)
+	}
+
 	result, err := database.DB.Exec(
-		"INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)",
-		comment.PostID, comment.UserID, comment.Content,
+		"INSERT INTO comments (post_id, user_id, content, content_html) VALUES (?, ?, ?, ?)",
+		comment.PostID, comment.UserID, comment.Content, comment.ContentHTML,
 	)
 	if err != nil {
 		return 0, err
@@ -28,7 +37,7 @@ func CreateComment(comment Comment) (int, error) {
 }
 
 func GetCommentsByPostID(postID int) ([]Comment, error) {
-	rows, err := database.DB.Query("SELECT id, post_id, user_id, content, created_at FROM comments WHERE post_id = ?", postID)
+	rows, err := database.DB.Query("SELECT id, post_id, user_id, content, COALESCE(content_html, ''), created_at FROM comments WHERE post_id = ? ORDER BY id", postID)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +46,7 @@ func GetCommentsByPostID(postID int) ([]Comment, error) {
 	var comments []Comment
 	for rows.Next() {
 		var comment Comment
-		err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt)
+		err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.ContentHTML, &comment.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -56,7 +65,7 @@ func GetCommentsByPostID(postID int) ([]Comment, error) {
 
 func GetCommentsByUserID(userID int) ([]Comment, error) {
 	rows, err := database.DB.Query(`
-        SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, p.title 
+        SELECT c.id, c.post_id, c.user_id, c.content, COALESCE(c.content_html, ''), c.created_at, p.title
         FROM comments c
         JOIN posts p ON c.post_id = p.id
         WHERE c.user_id = ?
@@ -71,7 +80,7 @@ func GetCommentsByUserID(userID int) ([]Comment, error) {
 	for rows.Next() {
 		var comment Comment
 		var postTitle string
-		err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt, &postTitle)
+		err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.ContentHTML, &comment.CreatedAt, &postTitle)
 		if err != nil {
 			return nil, err
 		}
@@ -83,3 +92,28 @@ func GetCommentsByUserID(userID int) ([]Comment, error) {
 
 	return comments, nil
 }
+
+// DeleteComment removes a comment and returns the post it belonged to.
+func DeleteComment(id int) (int, error) {
+	var postID int
+	err := database.DB.QueryRow("SELECT post_id FROM comments WHERE id = ?", id).Scan(&postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	_, err = database.DB.Exec("DELETE FROM comments WHERE id = ?", id)
+	if err != nil {
+		return postID, err
+	}
+
+	_, err = database.DB.Exec("DELETE FROM mentions WHERE source_type = ? AND source_id = ?", TargetComment, id)
+	if err != nil {
+		return postID, err
+	}
+
+	_, err = database.DB.Exec("DELETE FROM notifications WHERE source_type = ? AND source_id = ?", TargetComment, id)
+	return postID, err
+}
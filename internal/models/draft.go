@@ -0,0 +1,110 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DraftNewPost is the draft context of the post being written.
+const DraftNewPost = "post"
+
+// A Draft is unsent text the user is writing in some context: a new post,
+// a comment on a post or a chat with another user. Title and Category are
+// only used by new posts.
+type Draft struct {
+	Context   string    `json:"context"`
+	Title     string    `json:"title,omitempty"`
+	Category  string    `json:"category,omitempty"`
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CommentDraft is the draft context of a comment on postID.
+func CommentDraft(postID int) string {
+	return fmt.Sprintf("comment:%d", postID)
+}
+
+// ChatDraft is the draft context of a message to userID.
+func ChatDraft(userID int) string {
+	return fmt.Sprintf("chat:%d", userID)
+}
+
+// ValidDraftContext reports whether context is DraftNewPost or a comment
+// or chat context with a positive ID.
+func ValidDraftContext(context string) bool {
+	if context == DraftNewPost {
+		return true
+	}
+	kind, id, ok := strings.Cut(context, ":")
+	if !ok || (kind != "comment" && kind != "chat") {
+		return false
+	}
+	n, err := strconv.Atoi(id)
+	return err == nil && n > 0 && strconv.Itoa(n) == id
+}
+
+// SaveDraft creates or replaces the draft of userID in d.Context.
+func SaveDraft(userID int, d Draft) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO drafts (user_id, context, title, category, content) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, context) DO UPDATE SET
+			title = excluded.title,
+			category = excluded.category,
+			content = excluded.content,
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, d.Context, d.Title, d.Category, d.Content)
+	return err
+}
+
+// GetDraft returns the draft of userID in context, or sql.ErrNoRows.
+func GetDraft(userID int, context string) (Draft, error) {
+	var d Draft
+	err := database.DB.QueryRow(
+		"SELECT context, title, category, content, updated_at FROM drafts WHERE user_id = ? AND context = ?",
+		userID, context,
+	).Scan(&d.Context, &d.Title, &d.Category, &d.Content, &d.UpdatedAt)
+	if err != nil {
+		return Draft{}, err
+	}
+	return d, nil
+}
+
+// GetDrafts returns all drafts of userID, most recently edited first.
+func GetDrafts(userID int) ([]Draft, error) {
+	rows, err := database.DB.Query(
+		"SELECT context, title, category, content, updated_at FROM drafts WHERE user_id = ? ORDER BY updated_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Draft
+	for rows.Next() {
+		var d Draft
+		if err := rows.Scan(&d.Context, &d.Title, &d.Category, &d.Content, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+// DeleteDraft removes the draft of userID in context. It returns
+// ErrNotFound when there was none.
+func DeleteDraft(userID int, context string) error {
+	result, err := database.DB.Exec("DELETE FROM drafts WHERE user_id = ? AND context = ?", userID, context)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
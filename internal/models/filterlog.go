@@ -0,0 +1,59 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"encoding/json"
+	"time"
+)
+
+// FilterLogEntry records content that the content filter acted on.
+// Verdicts holds the filter's JSON verdict list as-is.
+type FilterLogEntry struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"userId"`
+	Nickname  string          `json:"nickname,omitempty"`
+	Kind      string          `json:"kind"`
+	Action    string          `json:"action"`
+	Original  string          `json:"original"`
+	Filtered  string          `json:"filtered"`
+	Verdicts  json.RawMessage `json:"verdicts"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func LogFilterResult(entry FilterLogEntry) error {
+	_, err := database.DB.Exec(
+		"INSERT INTO filter_log (user_id, kind, action, original, filtered, verdicts) VALUES (?, ?, ?, ?, ?, ?)",
+		entry.UserID, entry.Kind, entry.Action, entry.Original, entry.Filtered, string(entry.Verdicts),
+	)
+	return err
+}
+
+// GetFilterLog returns the newest entries first, optionally only those with
+// the given action.
+func GetFilterLog(action string, limit, offset int) ([]FilterLogEntry, error) {
+	rows, err := database.DB.Query(`
+		SELECT f.id, f.user_id, COALESCE(u.nickname, ''), f.kind, f.action, f.original, f.filtered, f.verdicts, f.created_at
+		FROM filter_log f
+		LEFT JOIN users u ON u.id = f.user_id
+		WHERE ? = '' OR f.action = ?
+		ORDER BY f.id DESC
+		LIMIT ? OFFSET ?
+	`, action, action, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []FilterLogEntry
+	for rows.Next() {
+		var e FilterLogEntry
+		var verdicts string
+		err := rows.Scan(&e.ID, &e.UserID, &e.Nickname, &e.Kind, &e.Action, &e.Original, &e.Filtered, &verdicts, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Verdicts = json.RawMessage(verdicts)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
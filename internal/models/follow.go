@@ -0,0 +1,194 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"time"
+)
+
+// Things a user can follow.
+const (
+	FollowPost     = "post"
+	FollowCategory = "category"
+)
+
+// FollowedPost is a followed post with its latest activity. The embedded
+// post's UnreadComments counts the comments by others the follower has not
+// read yet.
+type FollowedPost struct {
+	Post
+	LastVisitAt    time.Time `json:"lastVisitAt"`
+	LastActivityAt time.Time `json:"lastActivityAt"`
+}
+
+// FollowedCategory is a followed category with the posts others wrote in it
+// since the follower last visited it.
+type FollowedCategory struct {
+	Category
+	LastVisitAt time.Time `json:"lastVisitAt"`
+	NewPosts    int       `json:"newPosts"`
+}
+
+// Follow makes userID follow a post or category. Following again keeps the
+// original last visit.
+func Follow(userID int, targetType string, targetID int) error {
+	_, err := database.DB.Exec(
+		"INSERT OR IGNORE INTO follows (user_id, target_type, target_id) VALUES (?, ?, ?)",
+		userID, targetType, targetID,
+	)
+	return err
+}
+
+func Unfollow(userID int, targetType string, targetID int) error {
+	result, err := database.DB.Exec(
+		"DELETE FROM follows WHERE user_id = ? AND target_type = ? AND target_id = ?",
+		userID, targetType, targetID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func IsFollowing(userID int, targetType string, targetID int) (bool, error) {
+	var count int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(*) FROM follows WHERE user_id = ? AND target_type = ? AND target_id = ?",
+		userID, targetType, targetID,
+	).Scan(&count)
+	return count > 0, err
+}
+
+// GetFollowedIDs returns the IDs of the posts or categories userID follows.
+func GetFollowedIDs(userID int, targetType string) (map[int]bool, error) {
+	rows, err := database.DB.Query(
+		"SELECT target_id FROM follows WHERE user_id = ? AND target_type = ?",
+		userID, targetType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// GetFollowers returns the users following a post or category.
+func GetFollowers(targetType string, targetID int) ([]int, error) {
+	rows, err := database.DB.Query(
+		"SELECT user_id FROM follows WHERE target_type = ? AND target_id = ?",
+		targetType, targetID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MarkVisited records that userID looked at a post or category they
+// follow. It does nothing for targets they do not follow.
+func MarkVisited(userID int, targetType string, targetID int) error {
+	_, err := database.DB.Exec(
+		"UPDATE follows SET last_visit_at = CURRENT_TIMESTAMP WHERE user_id = ? AND target_type = ? AND target_id = ?",
+		userID, targetType, targetID,
+	)
+	return err
+}
+
+// GetFollowedPosts returns the posts userID follows, most recently active
+// first.
+func GetFollowedPosts(userID int) ([]FollowedPost, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+postColumns+`, f.last_visit_at,
+		       COALESCE((SELECT MAX(c.created_at) FROM comments c WHERE c.post_id = p.id), p.created_at) AS last_activity,
+		       (SELECT COUNT(*) FROM comments c
+		        WHERE c.post_id = p.id AND c.user_id != f.user_id AND c.id > COALESCE(r.last_read_comment_id, 0))
+		FROM follows f
+		JOIN posts p ON p.id = f.target_id
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN post_reads r ON r.user_id = f.user_id AND r.post_id = p.id
+		WHERE f.user_id = ? AND f.target_type = ? AND p.publish_at IS NULL
+		ORDER BY last_activity DESC
+	`, userID, FollowPost)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []FollowedPost
+	for rows.Next() {
+		var fp FollowedPost
+		var lastActivity string
+		var unread int
+		post, err := scanPost(rows, &fp.LastVisitAt, &lastActivity, &unread)
+		if err != nil {
+			return nil, err
+		}
+		fp.Post = post
+		fp.UnreadComments = unread
+		fp.LastActivityAt = parseTimestamp(lastActivity)
+		posts = append(posts, fp)
+	}
+	return posts, rows.Err()
+}
+
+// GetFollowedCategories returns the categories userID follows.
+func GetFollowedCategories(userID int) ([]FollowedCategory, error) {
+	rows, err := database.DB.Query(`
+		SELECT c.id, c.name, c.created_at, f.last_visit_at,
+		       (SELECT COUNT(*) FROM posts p
+		        WHERE p.category = c.name AND p.user_id != f.user_id AND p.created_at > f.last_visit_at
+		          AND p.publish_at IS NULL)
+		FROM follows f
+		JOIN categories c ON c.id = f.target_id
+		WHERE f.user_id = ? AND f.target_type = ?
+		ORDER BY c.name
+	`, userID, FollowCategory)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []FollowedCategory
+	for rows.Next() {
+		var fc FollowedCategory
+		if err := rows.Scan(&fc.ID, &fc.Name, &fc.CreatedAt, &fc.LastVisitAt, &fc.NewPosts); err != nil {
+			return nil, err
+		}
+		categories = append(categories, fc)
+	}
+	return categories, rows.Err()
+}
+
+// parseTimestamp reads a timestamp computed in SQL, which the driver
+// returns as text rather than as a time.Time.
+func parseTimestamp(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"RTF/internal/markup"
+	"fmt"
+)
+
+// BackfillContentHTML renders the cached HTML of posts, comments and
+// messages written before it was stored.
+func BackfillContentHTML() error {
+	for _, table := range []string{"posts", "comments", "messages"} {
+		if err := backfillTable(table); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func backfillTable(table string) error {
+	rows, err := database.DB.Query("SELECT id, COALESCE(content, '') FROM " + table + " WHERE content_html IS NULL")
+	if err != nil {
+		return err
+	}
+
+	pending := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		pending[id] = content
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, content := range pending {
+		if _, err := database.DB.Exec("UPDATE "+table+" SET content_html = ? WHERE id = ?", markup.Render(content), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"time"
+)
+
+// maxMentions caps how many users a single post, comment or message can
+// mention.
+const maxMentions = 20
+
+// A Mention records that AuthorID mentioned UserID in a post, comment or
+// message. SourceType uses the report target names.
+type Mention struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"userId"`
+	AuthorID   int       `json:"authorId"`
+	AuthorName string    `json:"authorName,omitempty"`
+	SourceType string    `json:"sourceType"`
+	SourceID   int       `json:"sourceId"`
+	PostID     int       `json:"postId,omitempty"`
+	Read       bool      `json:"read"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// CreateMentions stores a copy of m for every user named in nicknames and
+// returns the stored mentions. Unknown nicknames, the author and users on
+// either side of a block with the author are skipped, as are mentions
+// already recorded for the same source.
+func CreateMentions(m Mention, nicknames []string) ([]Mention, error) {
+	if len(nicknames) > maxMentions {
+		nicknames = nicknames[:maxMentions]
+	}
+
+	var created []Mention
+	for _, nickname := range nicknames {
+		var userID int
+		err := database.DB.QueryRow("SELECT id FROM users WHERE nickname = ? COLLATE NOCASE", nickname).Scan(&userID)
+		if err != nil {
+			continue
+		}
+		if userID == m.AuthorID {
+			continue
+		}
+
+		blocked, err := IsBlockedBetween(userID, m.AuthorID)
+		if err != nil {
+			return created, err
+		}
+		if blocked {
+			continue
+		}
+
+		var postID interface{}
+		if m.PostID > 0 {
+			postID = m.PostID
+		}
+		result, err := database.DB.Exec(
+			"INSERT OR IGNORE INTO mentions (user_id, author_id, source_type, source_id, post_id) VALUES (?, ?, ?, ?, ?)",
+			userID, m.AuthorID, m.SourceType, m.SourceID, postID,
+		)
+		if err != nil {
+			return created, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return created, err
+		}
+
+		mention := m
+		mention.ID = int(id)
+		mention.UserID = userID
+		mention.CreatedAt = time.Now()
+		created = append(created, mention)
+	}
+	return created, nil
+}
+
+// GetMentions returns the mentions of userID, newest first.
+func GetMentions(userID int, unreadOnly bool, limit, offset int) ([]Mention, error) {
+	rows, err := database.DB.Query(`
+		SELECT m.id, m.user_id, m.author_id, u.nickname, m.source_type, m.source_id, COALESCE(m.post_id, 0), m.read, m.created_at
+		FROM mentions m
+		JOIN users u ON u.id = m.author_id
+		WHERE m.user_id = ? AND (? = 0 OR m.read = 0)
+		ORDER BY m.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mentions []Mention
+	for rows.Next() {
+		var m Mention
+		err := rows.Scan(&m.ID, &m.UserID, &m.AuthorID, &m.AuthorName, &m.SourceType, &m.SourceID, &m.PostID, &m.Read, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+func CountUnreadMentions(userID int) (int, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM mentions WHERE user_id = ? AND read = 0", userID).Scan(&count)
+	return count, err
+}
+
+// MarkMentionsRead marks the given mentions of userID as read, or all of
+// them when ids is empty.
+func MarkMentionsRead(userID int, ids []int) error {
+	if len(ids) == 0 {
+		_, err := database.DB.Exec("UPDATE mentions SET read = 1 WHERE user_id = ? AND read = 0", userID)
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := database.DB.Exec("UPDATE mentions SET read = 1 WHERE id = ? AND user_id = ?", id, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LookupNicknames returns up to limit users whose nickname starts with
+// prefix, for mention autocompletion.
+func LookupNicknames(prefix string, limit int) ([]User, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, nickname FROM users
+		WHERE nickname LIKE ? ESCAPE '\'
+		ORDER BY nickname COLLATE NOCASE
+		LIMIT ?
+	`, escapeLike(prefix)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Nickname); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func escapeLike(s string) string {
+	var out []rune
+	for _, r := range s {
+		if r == '\\' || r == '%' || r == '_' {
+			out = append(out, '\\')
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
@@ -2,25 +2,31 @@ package models
 
 import (
 	"RTF/internal/database"
+	"RTF/internal/markup"
 	"strings"
 	"time"
 )
 
 type Message struct {
-	ID         int       `json:"id"`
-	SenderID   int       `json:"senderId"`
-	ReceiverID int       `json:"receiverId"`
-	Content    string    `json:"content"`
-	CreatedAt  time.Time `json:"createdAt"`
-	Read       bool      `json:"read"`
-	IsImage    bool      `json:"isImage"`
-	SenderName string    `json:"senderName,omitempty"`
+	ID          int       `json:"id"`
+	SenderID    int       `json:"senderId"`
+	ReceiverID  int       `json:"receiverId"`
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"contentHtml"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Read        bool      `json:"read"`
+	IsImage     bool      `json:"isImage"`
+	SenderName  string    `json:"senderName,omitempty"`
 }
 
 func CreateMessage(message Message) (int, error) {
+	if message.ContentHTML == "" {
+		message.ContentHTML = markup.Render(message.Content)
+	}
+
 	result, err := database.DB.Exec(
-		"INSERT INTO messages (sender_id, receiver_id, content, is_image) VALUES (?, ?, ?, ?)",
-		message.SenderID, message.ReceiverID, message.Content, message.IsImage,
+		"INSERT INTO messages (sender_id, receiver_id, content, content_html, is_image) VALUES (?, ?, ?, ?, ?)",
+		message.SenderID, message.ReceiverID, message.Content, message.ContentHTML, message.IsImage,
 	)
 	if err != nil {
 		return 0, err
@@ -32,7 +38,7 @@ func CreateMessage(message Message) (int, error) {
 
 func GetMessagesBetweenUsers(userID1, userID2 int, limit, offset int) ([]Message, error) {
 	rows, err := database.DB.Query(`
-		SELECT m.id, m.sender_id, m.receiver_id, m.content, m.created_at, m.read, u.nickname
+		SELECT m.id, m.sender_id, m.receiver_id, m.content, COALESCE(m.content_html, ''), m.created_at, m.read, u.nickname
 		FROM messages m
 		JOIN users u ON m.sender_id = u.id
 		WHERE (m.sender_id = ? AND m.receiver_id = ?) OR (m.sender_id = ? AND m.receiver_id = ?)
@@ -48,7 +54,7 @@ func GetMessagesBetweenUsers(userID1, userID2 int, limit, offset int) ([]Message
 	for rows.Next() {
 		var message Message
 		var createdAt string
-		err := rows.Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.Content, &createdAt, &message.Read, &message.SenderName)
+		err := rows.Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.Content, &message.ContentHTML, &createdAt, &message.Read, &message.SenderName)
 		if err != nil {
 			return nil, err
 		}
@@ -150,10 +156,10 @@ func GetMessageByID(id int) (*Message, error) {
 	var senderID int
 
 	err := database.DB.QueryRow(`
-        SELECT id, sender_id, receiver_id, content, created_at, read, is_image
+        SELECT id, sender_id, receiver_id, content, COALESCE(content_html, ''), created_at, read, is_image
         FROM messages
         WHERE id = ?
-    `, id).Scan(&message.ID, &senderID, &message.ReceiverID, &message.Content, &message.CreatedAt, &message.Read, &message.IsImage)
+    `, id).Scan(&message.ID, &senderID, &message.ReceiverID, &message.Content, &message.ContentHTML, &message.CreatedAt, &message.Read, &message.IsImage)
 
 	if err != nil {
 		return nil, err
@@ -168,3 +174,26 @@ func GetMessageByID(id int) (*Message, error) {
 
 	return &message, nil
 }
+
+func DeleteMessage(id int) error {
+	result, err := database.DB.Exec("DELETE FROM messages WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	_, err = database.DB.Exec("DELETE FROM mentions WHERE source_type = ? AND source_id = ?", TargetMessage, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec("DELETE FROM notifications WHERE source_type = ? AND source_id = ?", TargetMessage, id)
+	return err
+}
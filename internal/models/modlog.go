@@ -0,0 +1,74 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"time"
+)
+
+// Moderation actions recorded in the audit log.
+const (
+	ActionDismissReport = "dismiss_report"
+	ActionDeleteContent = "delete_content"
+	ActionWarn          = "warn"
+	ActionBan           = "ban"
+	ActionUnban         = "unban"
+	ActionLockPost      = "lock_post"
+	ActionUnlockPost    = "unlock_post"
+	ActionPinPost       = "pin_post"
+	ActionUnpinPost     = "unpin_post"
+	ActionAnnounce      = "announce"
+	ActionUnannounce    = "unannounce"
+	ActionMute          = "mute"
+	ActionUnmute        = "unmute"
+	ActionSetRole       = "set_role"
+	ActionDeleteUser    = "delete_user"
+)
+
+type ModerationEntry struct {
+	ID            int       `json:"id"`
+	ModeratorID   int       `json:"moderatorId"`
+	ModeratorName string    `json:"moderatorName,omitempty"`
+	Action        string    `json:"action"`
+	TargetType    string    `json:"targetType"`
+	TargetID      int       `json:"targetId"`
+	ReportID      *int      `json:"reportId,omitempty"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func LogModeration(entry ModerationEntry) error {
+	_, err := database.DB.Exec(
+		"INSERT INTO moderation_log (moderator_id, action, target_type, target_id, report_id, reason) VALUES (?, ?, ?, ?, ?, ?)",
+		entry.ModeratorID, entry.Action, entry.TargetType, entry.TargetID, entry.ReportID, entry.Reason,
+	)
+	return err
+}
+
+// GetModerationLog returns the newest entries first. Moderators who have
+// since been deleted are listed without a name.
+func GetModerationLog(limit, offset int) ([]ModerationEntry, error) {
+	rows, err := database.DB.Query(`
+		SELECT l.id, l.moderator_id, COALESCE(u.nickname, ''), l.action, l.target_type, l.target_id,
+		       l.report_id, l.reason, l.created_at
+		FROM moderation_log l
+		LEFT JOIN users u ON u.id = l.moderator_id
+		ORDER BY l.id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ModerationEntry
+	for rows.Next() {
+		var e ModerationEntry
+		err := rows.Scan(&e.ID, &e.ModeratorID, &e.ModeratorName, &e.Action, &e.TargetType, &e.TargetID,
+			&e.ReportID, &e.Reason, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
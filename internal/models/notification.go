@@ -0,0 +1,136 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"time"
+)
+
+// Notification types.
+const (
+	// NotifyComment: someone commented on the user's post.
+	NotifyComment = "comment"
+	// NotifyReply: someone commented on a post the user follows.
+	NotifyReply = "reply"
+	// NotifyPost: someone posted in a category the user follows.
+	NotifyPost = "post"
+	// NotifyMention: someone mentioned the user.
+	NotifyMention = "mention"
+	// NotifyMessage: someone messaged the user while they were offline.
+	NotifyMessage = "message"
+	// NotifyWarning: a moderator warned the user over a report.
+	NotifyWarning = "warning"
+)
+
+// A Notification tells UserID that ActorID did something. SourceType and
+// SourceID name the post, comment or message involved.
+type Notification struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"userId"`
+	ActorID    int       `json:"actorId"`
+	ActorName  string    `json:"actorName,omitempty"`
+	Type       string    `json:"type"`
+	SourceType string    `json:"sourceType"`
+	SourceID   int       `json:"sourceId"`
+	PostID     int       `json:"postId,omitempty"`
+	Excerpt    string    `json:"excerpt"`
+	Read       bool      `json:"read"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func CreateNotification(n Notification) (int, error) {
+	var postID interface{}
+	if n.PostID > 0 {
+		postID = n.PostID
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO notifications (user_id, actor_id, type, source_type, source_id, post_id, excerpt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, n.UserID, n.ActorID, n.Type, n.SourceType, n.SourceID, postID, n.Excerpt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// GetNotifications returns userID's notifications, newest first.
+func GetNotifications(userID int, unreadOnly bool, limit, offset int) ([]Notification, error) {
+	rows, err := database.DB.Query(`
+		SELECT n.id, n.user_id, n.actor_id, COALESCE(u.nickname, ''), n.type, n.source_type, n.source_id,
+		       COALESCE(n.post_id, 0), n.excerpt, n.read, n.created_at
+		FROM notifications n
+		LEFT JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = ? AND (? = 0 OR n.read = 0)
+		ORDER BY n.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.ActorName, &n.Type, &n.SourceType, &n.SourceID,
+			&n.PostID, &n.Excerpt, &n.Read, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// UnreadNotificationCounts returns how many unread notifications userID
+// has of each type.
+func UnreadNotificationCounts(userID int) (map[string]int, error) {
+	rows, err := database.DB.Query(
+		"SELECT type, COUNT(*) FROM notifications WHERE user_id = ? AND read = 0 GROUP BY type",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var kind string
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, err
+		}
+		counts[kind] = count
+	}
+	return counts, rows.Err()
+}
+
+func CountUnreadNotifications(userID int) (int, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read = 0", userID).Scan(&count)
+	return count, err
+}
+
+func MarkNotificationRead(userID, id int) error {
+	result, err := database.DB.Exec("UPDATE notifications SET read = 1 WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func MarkAllNotificationsRead(userID int) error {
+	_, err := database.DB.Exec("UPDATE notifications SET read = 1 WHERE user_id = ? AND read = 0", userID)
+	return err
+}
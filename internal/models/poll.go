@@ -0,0 +1,224 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPollClosed      = errors.New("poll is closed")
+	ErrTooManyChoices  = errors.New("too many choices")
+	ErrInvalidChoice   = errors.New("option does not belong to the poll")
+	ErrDuplicateChoice = errors.New("option chosen twice")
+)
+
+// A Poll is attached to a post. MaxChoices is 1 for single choice polls.
+// Voters are only listed on options of polls that are not anonymous.
+type Poll struct {
+	ID         int          `json:"id"`
+	PostID     int          `json:"postId"`
+	Multiple   bool         `json:"multiple"`
+	MaxChoices int          `json:"maxChoices"`
+	ClosesAt   *time.Time   `json:"closesAt,omitempty"`
+	Anonymous  bool         `json:"anonymous"`
+	Options    []PollOption `json:"options"`
+	// TotalVoters counts users, not votes, so that multiple choice
+	// percentages can be shown.
+	TotalVoters int  `json:"totalVoters"`
+	Closed      bool `json:"closed"`
+	// MyVotes is set per viewer: the options they chose.
+	MyVotes []int `json:"myVotes,omitempty"`
+}
+
+type PollOption struct {
+	ID     int      `json:"id"`
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+// IsClosed reports whether the poll no longer takes votes.
+func (p *Poll) IsClosed() bool {
+	return p.ClosesAt != nil && !time.Now().Before(*p.ClosesAt)
+}
+
+func createPoll(tx *sql.Tx, postID int, poll *Poll) error {
+	var closesAt interface{}
+	if poll.ClosesAt != nil {
+		closesAt = poll.ClosesAt.UTC()
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO polls (post_id, multiple, max_choices, closes_at, anonymous) VALUES (?, ?, ?, ?, ?)",
+		postID, poll.Multiple, poll.MaxChoices, closesAt, poll.Anonymous,
+	)
+	if err != nil {
+		return err
+	}
+	pollID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for i, option := range poll.Options {
+		if _, err := tx.Exec(
+			"INSERT INTO poll_options (poll_id, position, text) VALUES (?, ?, ?)",
+			pollID, i, option.Text,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPollByPostID returns the poll of a post with its current results, or
+// sql.ErrNoRows when the post has none.
+func GetPollByPostID(postID int) (*Poll, error) {
+	poll := Poll{PostID: postID}
+	var closesAt sql.NullTime
+	err := database.DB.QueryRow(
+		"SELECT id, multiple, max_choices, closes_at, anonymous FROM polls WHERE post_id = ?",
+		postID,
+	).Scan(&poll.ID, &poll.Multiple, &poll.MaxChoices, &closesAt, &poll.Anonymous)
+	if err != nil {
+		return nil, err
+	}
+	if closesAt.Valid {
+		poll.ClosesAt = &closesAt.Time
+	}
+	poll.Closed = poll.IsClosed()
+
+	rows, err := database.DB.Query(`
+		SELECT o.id, o.text, COUNT(v.user_id)
+		FROM poll_options o
+		LEFT JOIN poll_votes v ON v.option_id = o.id
+		WHERE o.poll_id = ?
+		GROUP BY o.id
+		ORDER BY o.position
+	`, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[int]int)
+	for rows.Next() {
+		var option PollOption
+		if err := rows.Scan(&option.ID, &option.Text, &option.Votes); err != nil {
+			return nil, err
+		}
+		index[option.ID] = len(poll.Options)
+		poll.Options = append(poll.Options, option)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = database.DB.QueryRow(
+		"SELECT COUNT(DISTINCT user_id) FROM poll_votes WHERE poll_id = ?",
+		poll.ID,
+	).Scan(&poll.TotalVoters)
+	if err != nil {
+		return nil, err
+	}
+
+	if !poll.Anonymous {
+		voters, err := database.DB.Query(`
+			SELECT v.option_id, u.nickname
+			FROM poll_votes v
+			JOIN users u ON u.id = v.user_id
+			WHERE v.poll_id = ?
+			ORDER BY v.created_at
+		`, poll.ID)
+		if err != nil {
+			return nil, err
+		}
+		defer voters.Close()
+
+		for voters.Next() {
+			var optionID int
+			var nickname string
+			if err := voters.Scan(&optionID, &nickname); err != nil {
+				return nil, err
+			}
+			if i, ok := index[optionID]; ok {
+				poll.Options[i].Voters = append(poll.Options[i].Voters, nickname)
+			}
+		}
+		if err := voters.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &poll, nil
+}
+
+// GetPollVotes returns the options userID chose in a poll.
+func GetPollVotes(pollID, userID int) ([]int, error) {
+	rows, err := database.DB.Query(
+		"SELECT option_id FROM poll_votes WHERE poll_id = ? AND user_id = ? ORDER BY option_id",
+		pollID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Vote replaces the choices userID made in poll with optionIDs. An empty
+// optionIDs withdraws their vote.
+func Vote(poll *Poll, userID int, optionIDs []int) error {
+	if poll.IsClosed() {
+		return ErrPollClosed
+	}
+	if len(optionIDs) > poll.MaxChoices {
+		return ErrTooManyChoices
+	}
+
+	valid := make(map[int]bool)
+	for _, option := range poll.Options {
+		valid[option.ID] = true
+	}
+	seen := make(map[int]bool)
+	for _, id := range optionIDs {
+		if !valid[id] {
+			return ErrInvalidChoice
+		}
+		if seen[id] {
+			return ErrDuplicateChoice
+		}
+		seen[id] = true
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?", poll.ID, userID); err != nil {
+		return err
+	}
+	for _, id := range optionIDs {
+		if _, err := tx.Exec(
+			"INSERT INTO poll_votes (poll_id, option_id, user_id) VALUES (?, ?, ?)",
+			poll.ID, id, userID,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -2,23 +2,96 @@ package models
 
 import (
 	"RTF/internal/database"
+	"RTF/internal/markup"
+	"database/sql"
 	"time"
 )
 
+// Pin scopes. A post pinned to its category is only lifted to the top of
+// that category's listing.
+const (
+	PinGlobal   = "global"
+	PinCategory = "category"
+)
+
 type Post struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"userId"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	Category  string    `json:"category"`
-	CreatedAt time.Time `json:"createdAt"`
-	User      *User     `json:"user,omitempty"`
+	ID      int    `json:"id"`
+	UserID  int    `json:"userId"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// ContentHTML is Content rendered from Markdown when the post is
+	// written.
+	ContentHTML string    `json:"contentHtml"`
+	Category    string    `json:"category"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Locked      bool      `json:"locked"`
+	// Pinned is PinGlobal, PinCategory or empty.
+	Pinned string `json:"pinned,omitempty"`
+	// Announcement posts are listed above everything else in every feed.
+	Announcement bool `json:"announcement"`
+	// PublishAt is set while the post is scheduled. Until then only its
+	// author can see it.
+	PublishAt *time.Time `json:"publishAt,omitempty"`
+	User      *User      `json:"user,omitempty"`
+	Poll      *Poll      `json:"poll,omitempty"`
+	// Collapsed is set per viewer when they blocked the author.
+	Collapsed bool `json:"collapsed,omitempty"`
+	// UnreadComments is set per viewer in listings: the comments by others
+	// newer than the last one they read.
+	UnreadComments int `json:"unreadComments"`
+}
+
+// postColumns selects a post joined as p with its author as u, in the
+// order scanPost reads them.
+const postColumns = `p.id, p.user_id, p.title, p.content, COALESCE(p.content_html, ''), p.category, p.created_at, p.locked,
+	p.pinned, p.announcement, p.publish_at, u.id, u.nickname, u.email`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPost reads postColumns followed by any extra columns of the query.
+func scanPost(row rowScanner, extra ...interface{}) (Post, error) {
+	var post Post
+	var user User
+	var publishAt sql.NullTime
+
+	dest := []interface{}{
+		&post.ID, &post.UserID, &post.Title, &post.Content, &post.ContentHTML, &post.Category, &post.CreatedAt, &post.Locked,
+		&post.Pinned, &post.Announcement, &publishAt, &user.ID, &user.Nickname, &user.Email,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return Post{}, err
+	}
+
+	if publishAt.Valid {
+		post.PublishAt = &publishAt.Time
+	}
+	post.User = &user
+	return post, nil
 }
 
+// CreatePost stores a post and its poll. A post with a PublishAt stays
+// scheduled until PublishPost is called for it.
 func CreatePost(post Post) (int, error) {
-	result, err := database.DB.Exec(
-		"INSERT INTO posts (user_id, title, content, category) VALUES (?, ?, ?, ?)",
-		post.UserID, post.Title, post.Content, post.Category,
+	if post.ContentHTML == "" {
+		post.ContentHTML = markup.Render(post.Content)
+	}
+
+	var publishAt interface{}
+	if post.PublishAt != nil {
+		publishAt = post.PublishAt.UTC()
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO posts (user_id, title, content, content_html, category, publish_at) VALUES (?, ?, ?, ?, ?, ?)",
+		post.UserID, post.Title, post.Content, post.ContentHTML, post.Category, publishAt,
 	)
 	if err != nil {
 		return 0, err
@@ -29,17 +102,106 @@ func CreatePost(post Post) (int, error) {
 		return 0, err
 	}
 
+	if post.Poll != nil {
+		if err := createPoll(tx, int(id), post.Poll); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
 	return int(id), nil
 }
 
+// GetAllPosts lists the published posts: announcements first, then
+// globally pinned posts, most recently pinned first, then the rest, newest
+// first.
 func GetAllPosts() ([]Post, error) {
-	rows, err := database.DB.Query(`
-		SELECT p.id, p.user_id, p.title, p.content, p.category, p.created_at, 
-		       u.id, u.nickname, u.email
+	return queryPosts(`
+		SELECT ` + postColumns + `
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		ORDER BY p.created_at DESC
+		WHERE p.publish_at IS NULL
+		ORDER BY p.announcement DESC,
+		         CASE WHEN p.pinned = 'global' THEN p.pinned_at END DESC,
+		         p.created_at DESC, p.id DESC
 	`)
+}
+
+// GetPostByID returns a published post with its poll, if it has one.
+// Scheduled posts are reported as sql.ErrNoRows.
+func GetPostByID(id int) (Post, error) {
+	return getPost(`
+		SELECT `+postColumns+`
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = ? AND p.publish_at IS NULL
+	`, id)
+}
+
+// GetScheduledPost returns a post of userID that is still scheduled.
+func GetScheduledPost(id, userID int) (Post, error) {
+	return getPost(`
+		SELECT `+postColumns+`
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = ? AND p.user_id = ? AND p.publish_at IS NOT NULL
+	`, id, userID)
+}
+
+func getPost(query string, args ...interface{}) (Post, error) {
+	post, err := scanPost(database.DB.QueryRow(query, args...))
+	if err != nil {
+		return Post{}, err
+	}
+
+	poll, err := GetPollByPostID(post.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return Post{}, err
+	}
+	post.Poll = poll
+	return post, nil
+}
+
+// GetPostsByCategory lists the posts of a category together with the
+// announcements. Posts pinned either way come right after the
+// announcements.
+func GetPostsByCategory(category string) ([]Post, error) {
+	return queryPosts(`
+		SELECT `+postColumns+`
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE (p.category = ? OR p.announcement = 1) AND p.publish_at IS NULL
+		ORDER BY p.announcement DESC,
+		         CASE WHEN p.pinned != '' THEN p.pinned_at END DESC,
+		         p.created_at DESC, p.id DESC
+	`, category)
+}
+
+// GetPostsSince lists up to limit published posts created at or after
+// since, oldest first, so that a client can catch up on what it missed.
+// An empty category means all of them. Posts from the second of since are
+// included again; callers dedupe by ID.
+func GetPostsSince(since time.Time, category string, limit int) ([]Post, error) {
+	query := `
+		SELECT ` + postColumns + `
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		WHERE p.publish_at IS NULL AND p.created_at >= ?`
+	args := []interface{}{since.UTC().Format("2006-01-02 15:04:05")}
+	if category != "" {
+		query += " AND p.category = ?"
+		args = append(args, category)
+	}
+	query += " ORDER BY p.created_at, p.id LIMIT ?"
+	args = append(args, limit)
+
+	return queryPosts(query, args...)
+}
+
+func queryPosts(query string, args ...interface{}) ([]Post, error) {
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,71 +209,190 @@ func GetAllPosts() ([]Post, error) {
 
 	var posts []Post
 	for rows.Next() {
-		var post Post
-		var user User
-
-		err := rows.Scan(
-			&post.ID, &post.UserID, &post.Title, &post.Content, &post.Category, &post.CreatedAt,
-			&user.ID, &user.Nickname, &user.Email,
-		)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
-
-		post.User = &user
 		posts = append(posts, post)
 	}
 
-	return posts, nil
+	return posts, rows.Err()
 }
 
-func GetPostByID(id int) (Post, error) {
-	var post Post
-	var user User
-
-	err := database.DB.QueryRow(`
-		SELECT p.id, p.user_id, p.title, p.content, p.category, p.created_at, 
-		       u.id, u.nickname, u.email
+// GetScheduledPosts returns the posts userID scheduled, the next one due
+// first.
+func GetScheduledPosts(userID int) ([]Post, error) {
+	return queryPosts(`
+		SELECT `+postColumns+`
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		WHERE p.id = ?
-	`, id).Scan(
-		&post.ID, &post.UserID, &post.Title, &post.Content, &post.Category, &post.CreatedAt,
-		&user.ID, &user.Nickname, &user.Email,
-	)
+		WHERE p.user_id = ? AND p.publish_at IS NOT NULL
+		ORDER BY p.publish_at
+	`, userID)
+}
 
+// UpdateScheduledPost changes the text, category and publish time of a
+// post its author scheduled. It returns ErrNotFound when the post is not
+// theirs or already published.
+func UpdateScheduledPost(post Post) error {
+	if post.ContentHTML == "" {
+		post.ContentHTML = markup.Render(post.Content)
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE posts SET title = ?, content = ?, content_html = ?, category = ?, publish_at = ?
+		WHERE id = ? AND user_id = ? AND publish_at IS NOT NULL
+	`, post.Title, post.Content, post.ContentHTML, post.Category, post.PublishAt.UTC(), post.ID, post.UserID)
 	if err != nil {
-		return Post{}, err
+		return err
 	}
 
-	post.User = &user
-	return post, nil
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
 }
 
-func GetPostsByCategory(category string) ([]Post, error) {
-	rows, err := database.DB.Query(`
-		SELECT p.id, p.user_id, p.title, p.content, p.category, p.created_at, u.nickname
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		WHERE p.category = ?
-		ORDER BY p.created_at DESC
-	`, category)
+// GetDuePostIDs returns the scheduled posts whose publish time has come.
+func GetDuePostIDs(now time.Time) ([]int, error) {
+	rows, err := database.DB.Query(
+		"SELECT id FROM posts WHERE publish_at IS NOT NULL AND publish_at <= ? ORDER BY publish_at",
+		now.UTC(),
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []Post
+	var ids []int
 	for rows.Next() {
-		var post Post
-		var createdAt string
-		err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.Category, &createdAt, &post.User.Nickname)
-		if err != nil {
+		var id int
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		post.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-		posts = append(posts, post)
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// PublishPost makes a scheduled post visible, dated now. It reports false
+// when the post was already published, so that only one instance announces
+// it.
+func PublishPost(id int) (bool, error) {
+	result, err := database.DB.Exec(
+		"UPDATE posts SET publish_at = NULL, created_at = CURRENT_TIMESTAMP WHERE id = ? AND publish_at IS NOT NULL",
+		id,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// SetPostLocked locks or unlocks a published post. Scheduled posts are
+// reported as ErrNotFound.
+func SetPostLocked(id int, locked bool) error {
+	result, err := database.DB.Exec("UPDATE posts SET locked = ? WHERE id = ? AND publish_at IS NULL", locked, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SetPostPinned pins a published post with the given scope, or unpins it
+// when scope is empty. Scheduled posts are reported as ErrNotFound.
+func SetPostPinned(id int, scope string) error {
+	result, err := database.DB.Exec(
+		"UPDATE posts SET pinned = ?, pinned_at = CASE WHEN ? = '' THEN NULL ELSE CURRENT_TIMESTAMP END WHERE id = ? AND publish_at IS NULL",
+		scope, scope, id,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// SetPostAnnouncement marks a published post as an announcement or clears
+// the mark. Scheduled posts are reported as ErrNotFound.
+func SetPostAnnouncement(id int, announcement bool) error {
+	result, err := database.DB.Exec("UPDATE posts SET announcement = ? WHERE id = ? AND publish_at IS NULL", announcement, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func DeletePost(id int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM comments WHERE post_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM mentions WHERE post_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM notifications WHERE post_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM follows WHERE target_type = ? AND target_id = ?", FollowPost, id); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM post_reads WHERE post_id = ?", id); err != nil {
+		return err
+	}
+
+	for _, statement := range []string{
+		"DELETE FROM poll_votes WHERE poll_id IN (SELECT id FROM polls WHERE post_id = ?)",
+		"DELETE FROM poll_options WHERE poll_id IN (SELECT id FROM polls WHERE post_id = ?)",
+		"DELETE FROM polls WHERE post_id = ?",
+		"DELETE FROM drafts WHERE context = 'comment:' || ?",
+	} {
+		if _, err := tx.Exec(statement, id); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM posts WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
 	}
 
-	return posts, nil
+	return tx.Commit()
 }
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"database/sql"
+)
+
+// GetLastReadComment returns the ID of the newest comment of postID that
+// userID has seen, or 0 if they never opened the post.
+func GetLastReadComment(userID, postID int) (int, error) {
+	var id int
+	err := database.DB.QueryRow(
+		"SELECT last_read_comment_id FROM post_reads WHERE user_id = ? AND post_id = ?",
+		userID, postID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// MarkPostRead records that userID has seen postID up to commentID. The
+// marker never moves backwards.
+func MarkPostRead(userID, postID, commentID int) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO post_reads (user_id, post_id, last_read_comment_id) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, post_id) DO UPDATE SET
+			last_read_comment_id = MAX(last_read_comment_id, excluded.last_read_comment_id),
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, postID, commentID)
+	return err
+}
+
+// UnreadCommentCounts returns, per post, how many comments by others are
+// newer than the last one userID read. Posts without unread comments are
+// left out.
+func UnreadCommentCounts(userID int) (map[int]int, error) {
+	rows, err := database.DB.Query(`
+		SELECT c.post_id, COUNT(*)
+		FROM comments c
+		LEFT JOIN post_reads r ON r.post_id = c.post_id AND r.user_id = ?
+		WHERE c.user_id != ? AND c.id > COALESCE(r.last_read_comment_id, 0)
+		GROUP BY c.post_id
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var postID, count int
+		if err := rows.Scan(&postID, &count); err != nil {
+			return nil, err
+		}
+		counts[postID] = count
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"time"
+)
+
+// Presence statuses a user can choose. StatusAway is also applied
+// automatically to idle users; invisible users appear offline to others.
+const (
+	StatusOnline    = "online"
+	StatusAway      = "away"
+	StatusDND       = "dnd"
+	StatusInvisible = "invisible"
+)
+
+func IsValidPresence(status string) bool {
+	switch status {
+	case StatusOnline, StatusAway, StatusDND, StatusInvisible:
+		return true
+	}
+	return false
+}
+
+// SetUserPresence stores the status userID chose, which is restored on
+// their next connection.
+func SetUserPresence(userID int, status string) error {
+	result, err := database.DB.Exec("UPDATE users SET presence = ? WHERE id = ?", status, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func UpdateLastSeen(userID int, at time.Time) error {
+	_, err := database.DB.Exec("UPDATE users SET last_seen_at = ? WHERE id = ?", at, userID)
+	return err
+}
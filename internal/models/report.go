@@ -0,0 +1,181 @@
+package models
+
+import (
+	"RTF/internal/database"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Things that can be reported. Moderation log entries use the same names
+// for their targets.
+const (
+	TargetPost    = "post"
+	TargetComment = "comment"
+	TargetMessage = "message"
+	TargetUser    = "user"
+)
+
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"
+	ReportDismissed = "dismissed"
+)
+
+var (
+	ErrDuplicateReport = errors.New("already reported")
+	ErrReportClosed    = errors.New("report already resolved")
+)
+
+type Report struct {
+	ID           int        `json:"id"`
+	ReporterID   int        `json:"reporterId"`
+	ReporterName string     `json:"reporterName,omitempty"`
+	TargetType   string     `json:"targetType"`
+	TargetID     int        `json:"targetId"`
+	TargetUserID int        `json:"targetUserId,omitempty"`
+	Reason       string     `json:"reason"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	ResolvedBy   *int       `json:"resolvedBy,omitempty"`
+	ResolvedAt   *time.Time `json:"resolvedAt,omitempty"`
+}
+
+func IsValidReportTarget(targetType string) bool {
+	switch targetType {
+	case TargetPost, TargetComment, TargetMessage, TargetUser:
+		return true
+	}
+	return false
+}
+
+func IsValidReportStatus(status string) bool {
+	return status == ReportOpen || status == ReportActioned || status == ReportDismissed
+}
+
+// CreateReport files a report. A reporter can only have one open report on
+// the same target.
+func CreateReport(report Report) (int, error) {
+	var count int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(*) FROM reports WHERE reporter_id = ? AND target_type = ? AND target_id = ? AND status = ?",
+		report.ReporterID, report.TargetType, report.TargetID, ReportOpen,
+	).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, ErrDuplicateReport
+	}
+
+	result, err := database.DB.Exec(
+		"INSERT INTO reports (reporter_id, target_type, target_id, target_user_id, reason) VALUES (?, ?, ?, ?, ?)",
+		report.ReporterID, report.TargetType, report.TargetID, report.TargetUserID, report.Reason,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+const reportColumns = `
+	r.id, r.reporter_id, u.nickname, r.target_type, r.target_id, COALESCE(r.target_user_id, 0),
+	r.reason, r.status, r.created_at, r.resolved_by, r.resolved_at
+`
+
+func scanReport(row interface{ Scan(...interface{}) error }) (Report, error) {
+	var r Report
+	err := row.Scan(&r.ID, &r.ReporterID, &r.ReporterName, &r.TargetType, &r.TargetID, &r.TargetUserID,
+		&r.Reason, &r.Status, &r.CreatedAt, &r.ResolvedBy, &r.ResolvedAt)
+	return r, err
+}
+
+// GetReports lists reports with the given status, oldest first so that the
+// moderation queue is worked in order.
+func GetReports(status string, limit, offset int) ([]Report, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+reportColumns+`
+		FROM reports r
+		JOIN users u ON u.id = r.reporter_id
+		WHERE r.status = ?
+		ORDER BY r.created_at, r.id
+		LIMIT ? OFFSET ?
+	`, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []Report
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+func GetReportByID(id int) (Report, error) {
+	report, err := scanReport(database.DB.QueryRow(`
+		SELECT `+reportColumns+`
+		FROM reports r
+		JOIN users u ON u.id = r.reporter_id
+		WHERE r.id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return Report{}, ErrNotFound
+	}
+	return report, err
+}
+
+// ResolveReport closes an open report together with every other open report
+// on the same target, since one decision settles them all. It returns the
+// number of reports closed.
+func ResolveReport(report Report, status string, moderatorID int) (int, error) {
+	result, err := database.DB.Exec(`
+		UPDATE reports SET status = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+		WHERE status = ? AND (id = ? OR (target_type = ? AND target_id = ?))
+	`, status, moderatorID, ReportOpen, report.ID, report.TargetType, report.TargetID)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrReportClosed
+	}
+	return int(affected), nil
+}
+
+// ContentAuthor returns the user responsible for a reportable target: the
+// author of a post or comment, the sender of a message, or the user
+// themselves. Scheduled posts are reported as ErrNotFound.
+func ContentAuthor(targetType string, targetID int) (int, error) {
+	var query string
+	switch targetType {
+	case TargetPost:
+		query = "SELECT user_id FROM posts WHERE id = ? AND publish_at IS NULL"
+	case TargetComment:
+		query = "SELECT user_id FROM comments WHERE id = ?"
+	case TargetMessage:
+		query = "SELECT sender_id FROM messages WHERE id = ?"
+	case TargetUser:
+		query = "SELECT id FROM users WHERE id = ?"
+	default:
+		return 0, errors.New("invalid target type")
+	}
+
+	var userID int
+	err := database.DB.QueryRow(query, targetID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
@@ -0,0 +1,60 @@
+package models
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+type Permission string
+
+const (
+	PermDeleteAnyPost    Permission = "delete_any_post"
+	PermLockPost         Permission = "lock_post"
+	PermPinPost          Permission = "pin_post"
+	PermMuteUser         Permission = "mute_user"
+	PermReviewReports    Permission = "review_reports"
+	PermBanUser          Permission = "ban_user"
+	PermManageCategories Permission = "manage_categories"
+	PermManageUsers      Permission = "manage_users"
+	PermManageRoles      Permission = "manage_roles"
+	PermAnnounce         Permission = "announce"
+)
+
+var moderatorPermissions = []Permission{
+	PermDeleteAnyPost,
+	PermLockPost,
+	PermPinPost,
+	PermMuteUser,
+	PermReviewReports,
+	PermBanUser,
+}
+
+var rolePermissions = map[string][]Permission{
+	RoleUser:      {},
+	RoleModerator: moderatorPermissions,
+	RoleAdmin: append([]Permission{
+		PermManageCategories,
+		PermManageUsers,
+		PermManageRoles,
+		PermAnnounce,
+	}, moderatorPermissions...),
+}
+
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func PermissionsForRole(role string) []Permission {
+	return rolePermissions[role]
+}
+
+func (u User) Can(permission Permission) bool {
+	for _, p := range rolePermissions[u.Role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
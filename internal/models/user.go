@@ -1,9 +1,11 @@
 package models
 
 import (
+	"RTF/internal/config"
 	"RTF/internal/database"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -11,15 +13,46 @@ import (
 )
 
 type User struct {
-	ID        int       `json:"id"`
-	Nickname  string    `json:"nickname"`
-	Age       int       `json:"age"`
-	Gender    string    `json:"gender"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID         int        `json:"id"`
+	Nickname   string     `json:"nickname"`
+	Age        int        `json:"age"`
+	Gender     string     `json:"gender"`
+	FirstName  string     `json:"firstName"`
+	LastName   string     `json:"lastName"`
+	Email      string     `json:"email"`
+	Password   string     `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Role       string     `json:"role"`
+	MutedUntil *time.Time `json:"mutedUntil,omitempty"`
+	// BannedAt is set while a ban is recorded; a nil BannedUntil makes it
+	// permanent.
+	BannedAt    *time.Time `json:"bannedAt,omitempty"`
+	BannedUntil *time.Time `json:"bannedUntil,omitempty"`
+	BanReason   string     `json:"banReason,omitempty"`
+	Presence    string     `json:"presence"`
+	LastSeenAt  *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrLastAdmin = errors.New("cannot remove the last admin")
+)
+
+// BanError is returned when a banned user signs in or uses a session.
+type BanError struct {
+	Until  *time.Time
+	Reason string
+}
+
+func (e *BanError) Error() string {
+	message := "account is banned"
+	if e.Until != nil {
+		message += " until " + e.Until.UTC().Format(time.RFC1123)
+	}
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	return message
 }
 
 type Session struct {
@@ -55,9 +88,9 @@ func AuthenticateUser(login, password string) (*User, error) {
 	var hashedPassword string
 
 	err := database.DB.QueryRow(
-		"SELECT id, nickname, age, gender, first_name, last_name, email, password FROM users WHERE nickname = ? OR email = ?",
+		"SELECT id, nickname, age, gender, first_name, last_name, email, password, role, muted_until, banned_at, banned_until, COALESCE(ban_reason, ''), presence, last_seen_at FROM users WHERE nickname = ? OR email = ?",
 		login, login,
-	).Scan(&user.ID, &user.Nickname, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &hashedPassword)
+	).Scan(&user.ID, &user.Nickname, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &hashedPassword, &user.Role, &user.MutedUntil, &user.BannedAt, &user.BannedUntil, &user.BanReason, &user.Presence, &user.LastSeenAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -71,6 +104,10 @@ func AuthenticateUser(login, password string) (*User, error) {
 		return nil, errors.New("invalid credentials")
 	}
 
+	if user.IsBanned() {
+		return nil, user.banError()
+	}
+
 	return &user, nil
 }
 
@@ -86,7 +123,7 @@ func CreateSession(userID int) (*Session, error) {
 	}
 
 	sessionID := uuid.String()
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+	expiresAt := time.Now().Add(config.Get().SessionTTL)
 
 	_, err = database.DB.Exec("INSERT INTO sessions (id, user_id, expires_at) VALUES (?, ?, ?)",
 		sessionID, userID, expiresAt)
@@ -102,11 +139,11 @@ func GetUserBySessionID(sessionID string) (User, error) {
 	var expiresAt *time.Time
 
 	err := database.DB.QueryRow(`
-		SELECT u.id, u.nickname, u.age, u.gender, u.first_name, u.last_name, u.email, s.expires_at
+		SELECT u.id, u.nickname, u.age, u.gender, u.first_name, u.last_name, u.email, u.role, u.muted_until, u.banned_at, u.banned_until, COALESCE(u.ban_reason, ''), u.presence, u.last_seen_at, s.expires_at
 		FROM users u
 		JOIN sessions s ON u.id = s.user_id
 		WHERE s.id = ?
-	`, sessionID).Scan(&user.ID, &user.Nickname, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &expiresAt)
+	`, sessionID).Scan(&user.ID, &user.Nickname, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &user.Role, &user.MutedUntil, &user.BannedAt, &user.BannedUntil, &user.BanReason, &user.Presence, &user.LastSeenAt, &expiresAt)
 
 	if err != nil {
 		return User{}, err
@@ -117,6 +154,11 @@ func GetUserBySessionID(sessionID string) (User, error) {
 		return User{}, errors.New("session expired")
 	}
 
+	if user.IsBanned() {
+		DeleteSession(sessionID)
+		return User{}, user.banError()
+	}
+
 	return user, nil
 }
 
@@ -126,7 +168,7 @@ func DeleteSession(sessionID string) error {
 }
 
 func GetAllUsers() ([]User, error) {
-	rows, err := database.DB.Query("SELECT id, nickname, age, gender, first_name, last_name, email, created_at FROM users")
+	rows, err := database.DB.Query("SELECT id, nickname, age, gender, first_name, last_name, email, created_at, role, muted_until, banned_at, banned_until, COALESCE(ban_reason, ''), presence, last_seen_at FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +177,7 @@ func GetAllUsers() ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var user User
-		err := rows.Scan(&user.ID, &user.Nickname, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &user.CreatedAt)
+		err := rows.Scan(&user.ID, &user.Nickname, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &user.CreatedAt, &user.Role, &user.MutedUntil, &user.BannedAt, &user.BannedUntil, &user.BanReason, &user.Presence, &user.LastSeenAt)
 		if err != nil {
 			return nil, err
 		}
@@ -149,9 +191,9 @@ func GetUserByID(id int) (User, error) {
 	var user User
 
 	err := database.DB.QueryRow(`
-		SELECT id, nickname, age, gender, first_name, last_name, email, created_at 
+		SELECT id, nickname, age, gender, first_name, last_name, email, created_at, role, muted_until, banned_at, banned_until, COALESCE(ban_reason, ''), presence, last_seen_at
 		FROM users WHERE id = ?
-	`, id).Scan(&user.ID, &user.Nickname, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &user.CreatedAt)
+	`, id).Scan(&user.ID, &user.Nickname, &user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Email, &user.CreatedAt, &user.Role, &user.MutedUntil, &user.BannedAt, &user.BannedUntil, &user.BanReason, &user.Presence, &user.LastSeenAt)
 
 	if err != nil {
 		return User{}, err
@@ -167,3 +209,186 @@ func UpdateUserAvatar(userID int, filename string) error {
 	)
 	return err
 }
+
+func (u User) IsMuted() bool {
+	return u.MutedUntil != nil && u.MutedUntil.After(time.Now())
+}
+
+func MuteUser(userID int, until *time.Time) error {
+	result, err := database.DB.Exec("UPDATE users SET muted_until = ? WHERE id = ?", until, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+// IsBanned reports whether a ban is in force; temporary bans lapse by
+// themselves once BannedUntil has passed.
+func (u User) IsBanned() bool {
+	return u.BannedAt != nil && (u.BannedUntil == nil || u.BannedUntil.After(time.Now()))
+}
+
+func (u User) banError() *BanError {
+	return &BanError{Until: u.BannedUntil, Reason: u.BanReason}
+}
+
+// BanUser bans a user until the given time, or indefinitely when until is
+// nil, and ends all of their sessions.
+func BanUser(userID int, until *time.Time, reason string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE users SET banned_at = CURRENT_TIMESTAMP, banned_until = ?, ban_reason = ? WHERE id = ?",
+		until, reason, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func UnbanUser(userID int) error {
+	result, err := database.DB.Exec(
+		"UPDATE users SET banned_at = NULL, banned_until = NULL, ban_reason = NULL WHERE id = ?",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func countOtherAdmins(userID int) (int, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM users WHERE role = ? AND id != ?", RoleAdmin, userID).Scan(&count)
+	return count, err
+}
+
+// PromoteAdmin makes the account whose nickname or email is login an admin.
+// It reports whether the account was not one already, and returns
+// sql.ErrNoRows when there is no such account.
+func PromoteAdmin(login string) (bool, error) {
+	var id int
+	var role string
+	err := database.DB.QueryRow("SELECT id, role FROM users WHERE nickname = ? OR email = ?", login, login).Scan(&id, &role)
+	if err != nil {
+		return false, err
+	}
+	if role == RoleAdmin {
+		return false, nil
+	}
+
+	if _, err := database.DB.Exec("UPDATE users SET role = ? WHERE id = ?", RoleAdmin, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func SetUserRole(userID int, role string) error {
+	if !IsValidRole(role) {
+		return errors.New("invalid role")
+	}
+
+	user, err := GetUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if user.Role == RoleAdmin && role != RoleAdmin {
+		others, err := countOtherAdmins(userID)
+		if err != nil {
+			return err
+		}
+		if others == 0 {
+			return ErrLastAdmin
+		}
+	}
+
+	_, err = database.DB.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	return err
+}
+
+func DeleteUser(userID int) error {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if user.Role == RoleAdmin {
+		others, err := countOtherAdmins(userID)
+		if err != nil {
+			return err
+		}
+		if others == 0 {
+			return ErrLastAdmin
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"DELETE FROM sessions WHERE user_id = ?",
+		"DELETE FROM messages WHERE sender_id = ? OR receiver_id = ?",
+		"DELETE FROM user_blocks WHERE user_id = ? OR blocked_id = ?",
+		"DELETE FROM reports WHERE reporter_id = ?",
+		"DELETE FROM drafts WHERE user_id = ? OR context = 'chat:' || ? OR context IN (SELECT 'comment:' || id FROM posts WHERE user_id = ?)",
+		"DELETE FROM mentions WHERE user_id = ? OR author_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)",
+		"DELETE FROM notifications WHERE user_id = ? OR actor_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)",
+		"DELETE FROM follows WHERE user_id = ? OR (target_type = 'post' AND target_id IN (SELECT id FROM posts WHERE user_id = ?))",
+		"DELETE FROM post_reads WHERE user_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)",
+		"DELETE FROM poll_votes WHERE user_id = ? OR poll_id IN (SELECT id FROM polls WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?))",
+		"DELETE FROM poll_options WHERE poll_id IN (SELECT id FROM polls WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?))",
+		"DELETE FROM polls WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)",
+		"DELETE FROM comments WHERE user_id = ? OR post_id IN (SELECT id FROM posts WHERE user_id = ?)",
+		"DELETE FROM posts WHERE user_id = ?",
+		"DELETE FROM users WHERE id = ?",
+	}
+	for _, statement := range statements {
+		args := make([]interface{}, strings.Count(statement, "?"))
+		for i := range args {
+			args[i] = userID
+		}
+		if _, err := tx.Exec(statement, args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
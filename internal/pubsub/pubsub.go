@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+var ErrClosed = errors.New("pubsub closed")
+
+// Handler receives the payload of every message published on a topic it
+// subscribed to. Handlers must not block for long: Memory runs them on the
+// publishing goroutine and Redis on its single reader goroutine.
+type Handler func(payload []byte)
+
+// PubSub fans messages out to every subscriber of a topic, possibly across
+// processes.
+type PubSub interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, handler Handler) error
+	Close() error
+}
+
+// New returns the PubSub described by rawURL: "memory" (or empty) for a
+// process-local bus, or "redis://[:password@]host:port" for Redis.
+func New(rawURL string) (PubSub, error) {
+	if rawURL == "" || rawURL == "memory" {
+		return NewMemory(), nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubsub URL: %v", err)
+	}
+
+	switch u.Scheme {
+	case "redis":
+		password, _ := u.User.Password()
+		return NewRedis(u.Host, password)
+	default:
+		return nil, fmt.Errorf("unsupported pubsub scheme %q", u.Scheme)
+	}
+}
+
+// Memory is a process-local PubSub. Publish delivers synchronously.
+type Memory struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	closed   bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{handlers: make(map[string][]Handler)}
+}
+
+func (m *Memory) Publish(topic string, payload []byte) error {
+	m.mu.RLock()
+	if m.closed {
+		m.mu.RUnlock()
+		return ErrClosed
+	}
+	handlers := append([]Handler(nil), m.handlers[topic]...)
+	m.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(topic string, handler Handler) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+	m.handlers[topic] = append(m.handlers[topic], handler)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	m.handlers = make(map[string][]Handler)
+	return nil
+}
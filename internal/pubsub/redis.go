@@ -0,0 +1,359 @@
+package pubsub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	redisDialTimeout  = 5 * time.Second
+	redisWriteTimeout = 5 * time.Second
+	redisReadTimeout  = 5 * time.Second
+	redisMaxBackoff   = 10 * time.Second
+)
+
+// Redis is a PubSub backed by Redis PUBLISH/SUBSCRIBE, speaking RESP over
+// two connections: one for publishing and one held in subscriber mode. The
+// subscriber reconnects with backoff and resubscribes on failure; messages
+// published while it is disconnected are lost, as with Redis pub/sub itself.
+type Redis struct {
+	addr     string
+	password string
+
+	pubMu   sync.Mutex
+	pubConn *redisConn
+
+	subMu    sync.Mutex
+	subConn  *redisConn
+	handlers map[string][]Handler
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+func NewRedis(addr, password string) (*Redis, error) {
+	r := &Redis{
+		addr:     addr,
+		password: password,
+		handlers: make(map[string][]Handler),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// Fail fast on a bad address rather than discovering it on first publish.
+	conn, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+	r.pubConn = conn
+
+	go r.subscribeLoop()
+	return r, nil
+}
+
+func (r *Redis) Publish(topic string, payload []byte) error {
+	select {
+	case <-r.closed:
+		return ErrClosed
+	default:
+	}
+
+	r.pubMu.Lock()
+	defer r.pubMu.Unlock()
+
+	if r.pubConn == nil {
+		conn, err := r.dial()
+		if err != nil {
+			return err
+		}
+		r.pubConn = conn
+	}
+
+	if err := r.pubConn.writeCommand("PUBLISH", []byte(topic), payload); err != nil {
+		r.pubConn.Close()
+		r.pubConn = nil
+		return err
+	}
+
+	// Only the subscriber waits for replies indefinitely.
+	r.pubConn.conn.SetReadDeadline(time.Now().Add(redisReadTimeout))
+	reply, err := r.pubConn.readReply()
+	if err != nil {
+		r.pubConn.Close()
+		r.pubConn = nil
+		return err
+	}
+	if replyErr, ok := reply.(redisError); ok {
+		return replyErr
+	}
+	return nil
+}
+
+func (r *Redis) Subscribe(topic string, handler Handler) error {
+	select {
+	case <-r.closed:
+		return ErrClosed
+	default:
+	}
+
+	r.subMu.Lock()
+	defer r.subMu.Unlock()
+
+	first := len(r.handlers[topic]) == 0
+	r.handlers[topic] = append(r.handlers[topic], handler)
+
+	// When disconnected, subscribeLoop subscribes to every known topic once
+	// it reconnects.
+	if first && r.subConn != nil {
+		if err := r.subConn.writeCommand("SUBSCRIBE", []byte(topic)); err != nil {
+			r.subConn.Close()
+		}
+	}
+	return nil
+}
+
+func (r *Redis) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+
+		r.pubMu.Lock()
+		if r.pubConn != nil {
+			r.pubConn.Close()
+			r.pubConn = nil
+		}
+		r.pubMu.Unlock()
+
+		r.subMu.Lock()
+		if r.subConn != nil {
+			r.subConn.Close()
+		}
+		r.subMu.Unlock()
+	})
+
+	<-r.done
+	return nil
+}
+
+func (r *Redis) subscribeLoop() {
+	defer close(r.done)
+
+	backoff := 100 * time.Millisecond
+	for {
+		select {
+		case <-r.closed:
+			return
+		default:
+		}
+
+		err := r.runSubscriber()
+
+		select {
+		case <-r.closed:
+			return
+		default:
+		}
+
+		log.Printf("Redis subscriber disconnected: %v, retrying in %v", err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-r.closed:
+			return
+		}
+
+		backoff *= 2
+		if backoff > redisMaxBackoff {
+			backoff = redisMaxBackoff
+		}
+	}
+}
+
+// runSubscriber connects, subscribes to every known topic and dispatches
+// messages until the connection fails.
+func (r *Redis) runSubscriber() error {
+	conn, err := r.dial()
+	if err != nil {
+		return err
+	}
+
+	r.subMu.Lock()
+	select {
+	case <-r.closed:
+		r.subMu.Unlock()
+		conn.Close()
+		return ErrClosed
+	default:
+	}
+	topics := make([][]byte, 0, len(r.handlers))
+	for topic := range r.handlers {
+		topics = append(topics, []byte(topic))
+	}
+	if len(topics) > 0 {
+		if err := conn.writeCommand("SUBSCRIBE", topics...); err != nil {
+			r.subMu.Unlock()
+			conn.Close()
+			return err
+		}
+	}
+	r.subConn = conn
+	r.subMu.Unlock()
+
+	defer func() {
+		r.subMu.Lock()
+		r.subConn = nil
+		r.subMu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		reply, err := conn.readReply()
+		if err != nil {
+			return err
+		}
+
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 {
+			continue
+		}
+		kind, _ := parts[0].([]byte)
+		topic, _ := parts[1].([]byte)
+		payload, _ := parts[2].([]byte)
+		if string(kind) != "message" {
+			continue
+		}
+
+		r.subMu.Lock()
+		handlers := append([]Handler(nil), r.handlers[string(topic)]...)
+		r.subMu.Unlock()
+
+		for _, handler := range handlers {
+			handler(payload)
+		}
+	}
+}
+
+func (r *Redis) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", r.addr, redisDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to redis at %s: %v", r.addr, err)
+	}
+
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+	if r.password != "" {
+		if err := conn.writeCommand("AUTH", []byte(r.password)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn.conn.SetReadDeadline(time.Now().Add(redisReadTimeout))
+		reply, err := conn.readReply()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if replyErr, ok := reply.(redisError); ok {
+			conn.Close()
+			return nil, replyErr
+		}
+		conn.conn.SetReadDeadline(time.Time{})
+	}
+
+	return conn, nil
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn reads and writes the subset of RESP needed for pub/sub.
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *redisConn) writeCommand(name string, args ...[]byte) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)+1), 10)
+	buf = append(buf, '\r', '\n')
+	buf = appendBulk(buf, []byte(name))
+	for _, arg := range args {
+		buf = appendBulk(buf, arg)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(redisWriteTimeout))
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func appendBulk(buf, value []byte) []byte {
+	buf = append(buf, '$')
+	buf = strconv.AppendInt(buf, int64(len(value)), 10)
+	buf = append(buf, '\r', '\n')
+	buf = append(buf, value...)
+	return append(buf, '\r', '\n')
+}
+
+// readReply returns a string or []byte for simple and bulk strings, int64
+// for integers, []interface{} for arrays, nil for null and redisError for
+// error replies.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	prefix, body := line[0], line[1:len(line)-2]
+
+	switch prefix {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis bulk length %q", body)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis array length %q", body)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply type %q", prefix)
+	}
+}
@@ -0,0 +1,232 @@
+package pubsub
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a stand-in for a Redis server that understands AUTH,
+// PUBLISH and SUBSCRIBE.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	conns       []net.Conn
+	subscribers map[string][]net.Conn
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	f := &fakeRedis{listener: listener, subscribers: make(map[string][]net.Conn)}
+	go f.serve()
+	t.Cleanup(func() { listener.Close(); f.dropConnections() })
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+// dropConnections closes every client connection, as a restarting server
+// would.
+func (f *fakeRedis) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+	f.subscribers = make(map[string][]net.Conn)
+}
+
+func (f *fakeRedis) subscriberCount(topic string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers[topic])
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	for {
+		reply, err := rc.readReply()
+		if err != nil {
+			return
+		}
+		args, ok := reply.([]interface{})
+		if !ok || len(args) == 0 {
+			return
+		}
+
+		command, _ := args[0].([]byte)
+		switch string(command) {
+		case "AUTH":
+			conn.Write([]byte("+OK\r\n"))
+		case "SUBSCRIBE":
+			f.mu.Lock()
+			for i, arg := range args[1:] {
+				topic := string(arg.([]byte))
+				f.subscribers[topic] = append(f.subscribers[topic], conn)
+				var out []byte
+				out = append(out, "*3\r\n"...)
+				out = appendBulk(out, []byte("subscribe"))
+				out = appendBulk(out, []byte(topic))
+				out = append(out, ':')
+				out = strconv.AppendInt(out, int64(i+1), 10)
+				out = append(out, '\r', '\n')
+				conn.Write(out)
+			}
+			f.mu.Unlock()
+		case "PUBLISH":
+			topic := args[1].([]byte)
+			payload := args[2].([]byte)
+
+			var out []byte
+			out = append(out, "*3\r\n"...)
+			out = appendBulk(out, []byte("message"))
+			out = appendBulk(out, topic)
+			out = appendBulk(out, payload)
+
+			f.mu.Lock()
+			subscribers := f.subscribers[string(topic)]
+			for _, sub := range subscribers {
+				sub.Write(out)
+			}
+			f.mu.Unlock()
+			conn.Write([]byte(":" + strconv.Itoa(len(subscribers)) + "\r\n"))
+		default:
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisDeliversAcrossClients(t *testing.T) {
+	server := newFakeRedis(t)
+
+	a, err := New("redis://:secret@" + server.addr())
+	if err != nil {
+		t.Fatalf("connect a: %v", err)
+	}
+	defer a.Close()
+	b, err := New("redis://" + server.addr())
+	if err != nil {
+		t.Fatalf("connect b: %v", err)
+	}
+	defer b.Close()
+
+	received := make(chan string, 1)
+	if err := b.Subscribe("events", func(payload []byte) { received <- string(payload) }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	waitFor(t, "subscription", func() bool { return server.subscriberCount("events") == 1 })
+
+	if err := a.Publish("events", []byte("hello\r\nworld")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if got != "hello\r\nworld" {
+			t.Fatalf("got %q, want %q", got, "hello\r\nworld")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not delivered")
+	}
+}
+
+func TestRedisResubscribesAfterDisconnect(t *testing.T) {
+	server := newFakeRedis(t)
+
+	ps, err := New("redis://" + server.addr())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer ps.Close()
+
+	received := make(chan string, 4)
+	ps.Subscribe("events", func(payload []byte) { received <- string(payload) })
+	waitFor(t, "subscription", func() bool { return server.subscriberCount("events") == 1 })
+
+	server.dropConnections()
+	waitFor(t, "resubscription", func() bool { return server.subscriberCount("events") == 1 })
+
+	// The publisher connection was dropped too; the first publish may fail
+	// while it notices, after which it redials.
+	if err := ps.Publish("events", []byte("again")); err != nil {
+		if err := ps.Publish("events", []byte("again")); err != nil {
+			t.Fatalf("publish after reconnect: %v", err)
+		}
+	}
+
+	select {
+	case got := <-received:
+		if got != "again" {
+			t.Fatalf("got %q, want %q", got, "again")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not delivered after reconnect")
+	}
+}
+
+func TestRedisPublishAfterClose(t *testing.T) {
+	server := newFakeRedis(t)
+
+	ps, err := New("redis://" + server.addr())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	ps.Close()
+
+	if err := ps.Publish("events", []byte("x")); err != ErrClosed {
+		t.Fatalf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestMemoryDeliversToAllSubscribers(t *testing.T) {
+	ps := NewMemory()
+
+	var got []string
+	ps.Subscribe("events", func(payload []byte) { got = append(got, "first:"+string(payload)) })
+	ps.Subscribe("events", func(payload []byte) { got = append(got, "second:"+string(payload)) })
+	ps.Subscribe("other", func(payload []byte) { got = append(got, "other:"+string(payload)) })
+
+	ps.Publish("events", []byte("x"))
+
+	if len(got) != 2 || got[0] != "first:x" || got[1] != "second:x" {
+		t.Fatalf("unexpected deliveries: %v", got)
+	}
+}
@@ -1,10 +1,17 @@
 package websocket
 
 import (
-	"encoding/json"
+	"RTF/internal/models"
+	"RTF/internal/pubsub"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"time"
+	"unicode/utf8"
+
+	"github.com/gofrs/uuid"
 )
 
 type Message struct {
@@ -14,81 +21,137 @@ type Message struct {
 	Timestamp time.Time   `json:"timestamp,omitempty"`
 }
 
-func Initialize() {
+// hub holds the clients connected to this instance.
+var hub = NewHub()
+
+// Initialize starts the hub and joins the cluster through ps. id identifies
+// this instance; a random one is generated when it is empty.
+func Initialize(ps pubsub.PubSub, id string) error {
 	log.Println("Initializing WebSocket broadcast system")
-	go func() {
-		for message := range broadcast {
-			Broadcast(message)
+
+	if id == "" {
+		generated, err := uuid.NewV4()
+		if err != nil {
+			return fmt.Errorf("error generating instance ID: %v", err)
 		}
-	}()
+		id = generated.String()
+	}
+	instanceID = id
+	bus = ps
+
+	hub.onPublish = func(target Target, message Message) {
+		publishEvent(clusterEvent{Kind: eventDeliver, Target: &target, Message: &message})
+	}
+	hub.onPresence = func(snapshot hubSnapshot) {
+		publishEvent(presenceEvent(snapshot))
+	}
+	hub.onOffline = func(userID int, at time.Time) {
+		// The hub must not block on the database.
+		go func() {
+			if err := models.UpdateLastSeen(userID, at); err != nil {
+				log.Printf("Error saving last seen time for user %d: %v", userID, err)
+			}
+		}()
+	}
+	hub.onViewers = func(room string, local int) {
+		publishEvent(clusterEvent{Kind: eventViewers, Room: room, Count: local})
+	}
+
+	if err := bus.Subscribe(clusterTopic, handleClusterEvent); err != nil {
+		return fmt.Errorf("error subscribing to cluster events: %v", err)
+	}
+
+	go relayLoop()
+	go hub.Run()
+	go presenceLoop()
+	go publishLoop()
+
+	log.Printf("WebSocket instance %s joined the cluster", instanceID)
+	return nil
 }
 
-func Broadcast(message Message) {
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling message of type '%s': %v", message.Type, err)
-		return
+// Shutdown tells every connected client that the server is going away,
+// flushes their pending messages and closes their connections. It returns
+// when all write pumps have finished or ctx expires.
+func Shutdown(ctx context.Context) error {
+	err := hub.Shutdown(ctx)
+
+	// An empty snapshot makes other instances drop our users right away
+	// instead of waiting for it to expire.
+	publishEvent(clusterEvent{Kind: eventPresence})
+	if bus != nil {
+		if flushErr := flushEvents(ctx); flushErr != nil {
+			log.Printf("Error flushing cluster events: %v", flushErr)
+		}
+		bus.Close()
 	}
+	return err
+}
 
-	clientsMutex.Lock()
-	defer clientsMutex.Unlock()
+// Send delivers message to the clients matched by target on this instance
+// and publishes it for the other instances.
+func Send(target Target, message Message) {
+	hub.Send(target, message)
+	if !target.local() {
+		publishEvent(clusterEvent{Kind: eventDeliver, Target: &target, Message: &message})
+	}
+}
 
-	sentCount := 0
-	failedCount := 0
+// Broadcast delivers message to every client on every instance.
+func Broadcast(message Message) {
+	Send(ToAll(), message)
+}
 
-	for client := range clients {
-		if message.Type == "chat_message" {
-			content, ok := message.Content.(map[string]interface{})
-			if !ok {
-				log.Printf("Invalid content format in chat message: %T", message.Content)
-				continue
-			}
+// SendToUser delivers message to userID's connections on every instance.
+func SendToUser(userID int, message Message) {
+	Send(ToUser(userID), message)
+}
 
-			receiverIDValue, exists := content["receiverId"]
-			if !exists {
-				log.Printf("Missing receiverId in chat message")
-				continue
-			}
+// DisconnectUser closes userID's connection on every instance with the given
+// close code and reason.
+func DisconnectUser(userID int, code int, reason string) {
+	reason = closeReason(reason)
+	hub.DisconnectUser(userID, code, reason)
+	publishEvent(clusterEvent{Kind: eventDisconnect, UserID: userID, Code: code, Reason: reason})
+}
 
-			var receiverID int
-			switch v := receiverIDValue.(type) {
-			case float64:
-				receiverID = int(v)
-			case int:
-				receiverID = v
-			case string:
-				_, err := fmt.Sscanf(v, "%d", &receiverID)
-				if err != nil || receiverID == 0 {
-					log.Printf("Invalid receiverId format: %v", v)
-					continue
-				}
-			default:
-				log.Printf("Invalid receiverId type in chat message: %T", receiverIDValue)
-				continue
-			}
+// DisconnectSession closes the connections userID opened with sessionID on
+// every instance, leaving their other logins connected.
+func DisconnectSession(userID int, sessionID string, code int, reason string) {
+	reason = closeReason(reason)
+	key := sessionKey(sessionID)
+	hub.DisconnectSession(userID, key, code, reason)
+	publishEvent(clusterEvent{Kind: eventDisconnect, UserID: userID, Session: key, Code: code, Reason: reason})
+}
 
-			if client.userID != message.Sender && client.userID != receiverID {
-				continue
-			}
-		}
+// RenameSession keeps the connections userID opened with oldID tied to
+// their login once the session ID is rotated to newID.
+func RenameSession(userID int, oldID, newID string) {
+	from, to := sessionKey(oldID), sessionKey(newID)
+	hub.RenameSession(userID, from, to)
+	publishEvent(clusterEvent{Kind: eventSession, UserID: userID, Session: from, NewSession: to})
+}
 
-		select {
-		case client.send <- messageJSON:
-			sentCount++
-		default:
-			log.Printf("Failed to send message to user %d, closing connection", client.userID)
-			close(client.send)
-			delete(clients, client)
-
-			onlineUsersMutex.Lock()
-			delete(onlineUsers, client.userID)
-			onlineUsersMutex.Unlock()
-			failedCount++
-		}
+// sessionKey identifies a session without revealing its ID, which must not
+// travel between instances.
+func sessionKey(sessionID string) string {
+	if sessionID == "" {
+		return ""
 	}
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:16])
+}
 
-	if message.Type != "ping" {
-		log.Printf("Broadcasted message type '%s' to %d clients (%d failed)",
-			message.Type, sentCount, failedCount)
+// closeReason shortens reason to fit in a close frame, which allows 123
+// bytes after the status code.
+func closeReason(reason string) string {
+	const maxCloseReason = 123
+	if len(reason) <= maxCloseReason {
+		return reason
+	}
+	reason = reason[:maxCloseReason]
+	for !utf8.ValidString(reason) {
+		reason = reason[:len(reason)-1]
 	}
+	return reason
 }
@@ -1,117 +1,97 @@
 package websocket
 
 import (
+	"RTF/internal/config"
 	"RTF/internal/database"
+	"RTF/internal/filter"
+	"RTF/internal/markup"
 	"RTF/internal/models"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
-	"sync"
 	"time"
 
 	gorillaWs "github.com/gorilla/websocket"
 )
 
-const (
-	writeWait = 10 * time.Second
-
-	pongWait = 60 * time.Second
-
-	pingPeriod = (pongWait * 9) / 10
-
-	maxMessageSize = 10000
+var (
+	// errLocked is returned when a comment is sent to a locked post.
+	errLocked = errors.New("post is locked")
+	// errBlocked is returned when one side of a conversation has blocked
+	// the other.
+	errBlocked = errors.New("conversation is blocked")
+	// errRejected is returned when the content filter refuses a message.
+	errRejected = errors.New("content rejected")
 )
 
 type Client struct {
+	hub    *Hub
 	conn   *gorillaWs.Conn
 	send   chan []byte
 	userID int
+	// session identifies the login the connection was opened with, as
+	// returned by sessionKey. It is owned by the hub goroutine.
+	session string
+	// status is the presence status the user chose when connecting.
+	status string
+	// done is closed when writePump exits, after any queued messages have
+	// been flushed.
+	done chan struct{}
+	// closeCode and closeReason are set by the hub before it closes send
+	// and are sent to the peer in the close frame.
+	closeCode   int
+	closeReason string
+	// rooms is owned by the hub goroutine.
+	rooms map[string]bool
+
+	// name and typingLimit are only used by readPump.
+	name        string
+	typingLimit *rateLimiter
 }
 
-var clientsMutex sync.Mutex
-var onlineUsersMutex sync.Mutex
-var clients = make(map[*Client]bool)
-var broadcast = make(chan Message)
-var onlineUsers = make(map[int]bool)
-
-func GetOnlineUsers() []int {
-	onlineUsersMutex.Lock()
-	defer onlineUsersMutex.Unlock()
-
-	var users []int
-	for userID := range onlineUsers {
-		users = append(users, userID)
-	}
-	return users
-}
-
-func HandleConnections(conn *gorillaWs.Conn, userID int) {
+// HandleConnections serves conn for userID, who authenticated with
+// sessionID.
+func HandleConnections(conn *gorillaWs.Conn, userID int, sessionID string) {
 	if conn == nil {
 		log.Printf("Error: Attempting to handle connection with nil WebSocket for user %d", userID)
 		return
 	}
 
-	DisconnectUser(userID)
+	// The hub replaces an existing local connection itself; other
+	// instances have to be told.
+	publishEvent(clusterEvent{
+		Kind:     eventDisconnect,
+		UserID:   userID,
+		Replaced: true,
+	})
 
-	client := &Client{
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		userID: userID,
+	status := models.StatusOnline
+	if user, err := models.GetUserByID(userID); err == nil && models.IsValidPresence(user.Presence) {
+		status = user.Presence
 	}
 
-	clientsMutex.Lock()
-	clients[client] = true
-	clientsMutex.Unlock()
-
-	onlineUsersMutex.Lock()
-	onlineUsers[userID] = true
-	onlineUsersMutex.Unlock()
-
-	log.Printf("User %d connected. Total connected clients: %d", userID, len(clients))
-
-	go client.readPump()
-	go client.writePump()
-
-	broadcast <- Message{
-		Type:      "user_online",
-		Content:   userID,
-		Timestamp: time.Now(),
-	}
+	hub.Connect(conn, userID, sessionKey(sessionID), status)
 }
 
 func (c *Client) readPump() {
 	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Recovered from panic in readPump for user %d: %v", c.userID, r)
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.stopped:
 		}
 
 		if err := c.conn.Close(); err != nil {
 			log.Printf("Error closing connection for user %d: %v", c.userID, err)
 		}
-
-		clientsMutex.Lock()
-		delete(clients, c)
-		clientsMutex.Unlock()
-
-		onlineUsersMutex.Lock()
-		delete(onlineUsers, c.userID)
-		onlineUsersMutex.Unlock()
-
-		log.Printf("User %d disconnected. Remaining connected clients: %d", c.userID, len(clients))
-
-		Broadcast(Message{
-			Type: "user_offline",
-			Content: map[string]interface{}{
-				"userId": c.userID,
-			},
-		})
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	cfg := config.Get()
+	c.conn.SetReadLimit(cfg.WSMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(cfg.WSPongWait))
 	c.conn.SetPongHandler(func(string) error {
-		err := c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		err := c.conn.SetReadDeadline(time.Now().Add(cfg.WSPongWait))
 		if err != nil {
 			log.Printf("Error setting read deadline for user %d: %v", c.userID, err)
 		}
@@ -138,34 +118,68 @@ func (c *Client) readPump() {
 		wsMessage.Sender = c.userID
 		wsMessage.Timestamp = time.Now()
 
+		// Heartbeat pings are sent by idle tabs too; everything else means
+		// the user is there.
+		if wsMessage.Type != "ping" {
+			c.hub.Touch(c.userID)
+		}
+
 		switch wsMessage.Type {
 		case "chat_message":
 			if err := handleChatMessage(wsMessage); err != nil {
 				log.Printf("Error handling chat message from user %d: %v", c.userID, err)
+				switch {
+				case errors.Is(err, errBlocked):
+					c.replyError("blocked", err.Error())
+				case errors.Is(err, errRejected):
+					c.replyError("content_rejected", err.Error())
+				}
 			}
 		case "new_comment":
 			if err := handleNewComment(wsMessage); err != nil {
 				log.Printf("Error handling new comment from user %d: %v", c.userID, err)
+				switch {
+				case errors.Is(err, errLocked):
+					c.replyError("locked", err.Error())
+				case errors.Is(err, errRejected):
+					c.replyError("content_rejected", err.Error())
+				}
 			}
-		case "user_online":
-			if err := handleUserOnline(wsMessage); err != nil {
-				log.Printf("Error handling user online message from user %d: %v", c.userID, err)
+		case "subscribe", "unsubscribe":
+			if err := handleSubscription(c, wsMessage); err != nil {
+				log.Printf("Error handling %s from user %d: %v", wsMessage.Type, c.userID, err)
+				c.replyError("invalid_topic", err.Error())
 			}
-		case "user_offline":
-			if err := handleUserOffline(wsMessage); err != nil {
-				log.Printf("Error handling user offline message from user %d: %v", c.userID, err)
+		case "activity":
+			// Handled by Touch above.
+		case "set_status":
+			if err := c.handleSetStatus(wsMessage); err != nil {
+				log.Printf("Error handling status change from user %d: %v", c.userID, err)
+				c.replyError("invalid_status", err.Error())
 			}
+		case "user_online", "user_offline":
+			// Presence is tracked by the hub from the connections
+			// themselves; clients cannot announce it.
+			log.Printf("Ignoring '%s' frame from user %d", wsMessage.Type, c.userID)
 		case "typing_start":
-			if err := handleTypingStart(wsMessage); err != nil {
+			if !c.typingLimit.allow() {
+				log.Printf("Dropping typing frame from user %d: rate limit exceeded", c.userID)
+				break
+			}
+			if err := c.handleTypingStart(wsMessage); err != nil {
 				log.Printf("Error handling typing start from user %d: %v", c.userID, err)
 			}
 		case "typing_stop":
-			if err := handleTypingStop(wsMessage); err != nil {
+			if !c.typingLimit.allow() {
+				log.Printf("Dropping typing frame from user %d: rate limit exceeded", c.userID)
+				break
+			}
+			if err := c.handleTypingStop(wsMessage); err != nil {
 				log.Printf("Error handling typing stop from user %d: %v", c.userID, err)
 			}
 		case "ping":
 			log.Printf("Received ping from user %d, sending pong", c.userID)
-			Broadcast(Message{
+			c.reply(Message{
 				Type:      "pong",
 				Sender:    c.userID,
 				Timestamp: time.Now(),
@@ -173,38 +187,53 @@ func (c *Client) readPump() {
 		default:
 			if strings.ToLower(wsMessage.Type) == "ping" {
 				log.Printf("Received ping (alternate format) from user %d, sending pong", c.userID)
-				Broadcast(Message{
+				c.reply(Message{
 					Type:      "pong",
 					Sender:    c.userID,
 					Timestamp: time.Now(),
 				})
 			} else {
 				log.Printf("Unknown message type '%s' from user %d", wsMessage.Type, c.userID)
-				Broadcast(wsMessage)
+				c.replyError("unknown_type", fmt.Sprintf("Unknown message type '%s'", wsMessage.Type))
 			}
 		}
 	}
 }
 
+// reply sends message to this connection only.
+func (c *Client) reply(message Message) {
+	c.hub.Send(toClient(c), message)
+}
+
+func (c *Client) replyError(code, text string) {
+	c.reply(Message{
+		Type: "error",
+		Content: map[string]interface{}{
+			"code":    code,
+			"message": text,
+		},
+		Timestamp: time.Now(),
+	})
+}
+
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	cfg := config.Get()
+	ticker := time.NewTicker(cfg.WSPingPeriod())
 	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Recovered from panic in writePump for user %d: %v", c.userID, r)
-		}
-
 		ticker.Stop()
 		if err := c.conn.Close(); err != nil {
 			log.Printf("Error closing connection in writePump for user %d: %v", c.userID, err)
 		}
+		close(c.done)
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(cfg.WSWriteWait))
 			if !ok {
-				c.conn.WriteMessage(gorillaWs.CloseMessage, []byte{})
+				c.conn.WriteMessage(gorillaWs.CloseMessage,
+					gorillaWs.FormatCloseMessage(c.closeCode, c.closeReason))
 				return
 			}
 
@@ -218,7 +247,7 @@ func (c *Client) writePump() {
 				return
 			}
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(cfg.WSWriteWait))
 			if err := c.conn.WriteMessage(gorillaWs.PingMessage, nil); err != nil {
 				return
 			}
@@ -257,12 +286,26 @@ func handleChatMessage(message Message) error {
 		return fmt.Errorf("invalid receiverId value: %d", receiverID)
 	}
 
-	onlineUsersMutex.Lock()
-	isReceiverOnline := onlineUsers[receiverID]
-	onlineUsersMutex.Unlock()
+	receiver, err := models.GetUserByID(receiverID)
+	if err != nil {
+		return fmt.Errorf("failed to load receiver %d: %w", receiverID, err)
+	}
 
-	if !isReceiverOnline {
-		return fmt.Errorf("cannot send message to offline user")
+	sender, err := models.GetUserByID(message.Sender)
+	if err != nil {
+		return fmt.Errorf("failed to load sender: %w", err)
+	}
+
+	if sender.IsMuted() {
+		return fmt.Errorf("sender is muted")
+	}
+
+	blocked, err := models.IsBlockedBetween(message.Sender, receiverID)
+	if err != nil {
+		return fmt.Errorf("failed to check blocks: %w", err)
+	}
+	if blocked {
+		return errBlocked
 	}
 
 	messageContent, ok := content["content"].(string)
@@ -274,18 +317,82 @@ func handleChatMessage(message Message) error {
 		return fmt.Errorf("empty message content")
 	}
 
-	_, err := database.DB.Exec(
-		"INSERT INTO messages (sender_id, receiver_id, content) VALUES (?, ?, ?)",
-		message.Sender, receiverID, messageContent,
+	result := filter.Check(filter.Content{Kind: filter.KindMessage, UserID: message.Sender, Text: messageContent})
+	if result.Rejected {
+		return fmt.Errorf("%w: %s", errRejected, result.Reason)
+	}
+	messageContent = result.Text
+	content["content"] = messageContent
+	contentHTML := markup.Render(messageContent)
+	content["contentHtml"] = contentHTML
+
+	inserted, err := database.DB.Exec(
+		"INSERT INTO messages (sender_id, receiver_id, content, content_html) VALUES (?, ?, ?, ?)",
+		message.Sender, receiverID, messageContent, contentHTML,
 	)
 	if err != nil {
 		return fmt.Errorf("database error saving message: %w", err)
 	}
+	messageID, err := inserted.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("database error saving message: %w", err)
+	}
+	content["id"] = messageID
 
 	content["receiverId"] = receiverID
 	message.Content = content
 
-	Broadcast(message)
+	hub.StopTyping(message.Sender, receiverID)
+	ClearDraft(message.Sender, models.ChatDraft(receiverID))
+
+	// A message is private, so only its receiver can be mentioned in it.
+	var mentioned []models.Mention
+	for _, nickname := range markup.Mentions(messageContent) {
+		if strings.EqualFold(nickname, receiver.Nickname) {
+			mentioned = NotifyMentions(models.Mention{
+				AuthorID:   message.Sender,
+				AuthorName: sender.Nickname,
+				SourceType: models.TargetMessage,
+				SourceID:   int(messageID),
+			}, []string{nickname}, messageContent)
+			break
+		}
+	}
+
+	// An offline receiver finds the message in their notifications.
+	if len(mentioned) == 0 && !IsUserOnline(receiverID) {
+		Notify(models.Notification{
+			UserID:     receiverID,
+			ActorID:    message.Sender,
+			ActorName:  sender.Nickname,
+			Type:       models.NotifyMessage,
+			SourceType: models.TargetMessage,
+			SourceID:   int(messageID),
+			Excerpt:    messageContent,
+		})
+	}
+
+	// A receiver who muted the sender still gets the message, flagged so
+	// that the client skips the notification.
+	muted, err := models.HasMuted(receiverID, message.Sender)
+	if err != nil {
+		log.Printf("Failed to check mute of user %d by user %d: %v", message.Sender, receiverID, err)
+	}
+	if !muted {
+		Send(ToConversation(message.Sender, receiverID), message)
+		return nil
+	}
+
+	mutedContent := make(map[string]interface{}, len(content)+1)
+	for k, v := range content {
+		mutedContent[k] = v
+	}
+	mutedContent["muted"] = true
+	mutedMessage := message
+	mutedMessage.Content = mutedContent
+
+	Send(ToUser(message.Sender), message)
+	Send(ToUser(receiverID), mutedMessage)
 	return nil
 }
 
@@ -329,108 +436,73 @@ func handleNewComment(message Message) error {
 		return fmt.Errorf("empty comment content")
 	}
 
-	_, err := database.DB.Exec(
-		"INSERT INTO comments (post_id, user_id, content) VALUES (?, ?, ?)",
-		postID, message.Sender, commentContent,
-	)
+	sender, err := models.GetUserByID(message.Sender)
 	if err != nil {
-		return fmt.Errorf("database error saving comment: %w", err)
+		return fmt.Errorf("failed to load sender: %w", err)
 	}
 
-	content["postId"] = postID
-	message.Content = content
-
-	Broadcast(message)
-	return nil
-}
-
-func handleUserOnline(message Message) error {
-	var userID int
-
-	switch v := message.Content.(type) {
-	case float64:
-		userID = int(v)
-	case int:
-		userID = v
-	case map[string]interface{}:
-		if idValue, exists := v["userId"]; exists {
-			switch id := idValue.(type) {
-			case float64:
-				userID = int(id)
-			case int:
-				userID = id
-			case string:
-				_, err := fmt.Sscanf(id, "%d", &userID)
-				if err != nil {
-					return fmt.Errorf("invalid userId format in user_online message: %v", id)
-				}
-			default:
-				return fmt.Errorf("invalid userId type in user_online message: %T", idValue)
-			}
-		} else {
-			return fmt.Errorf("missing userId in user_online message content")
-		}
-	default:
-		return fmt.Errorf("invalid user_online message content format: %T", message.Content)
+	if sender.IsMuted() {
+		return fmt.Errorf("sender is muted")
 	}
 
-	if userID <= 0 {
-		return fmt.Errorf("invalid userId value in user_online message: %d", userID)
+	post, err := models.GetPostByID(postID)
+	if err != nil {
+		return fmt.Errorf("failed to load post %d: %w", postID, err)
 	}
 
-	onlineUsersMutex.Lock()
-	onlineUsers[userID] = true
-	onlineUsersMutex.Unlock()
-	log.Printf("User %d is now online", userID)
-
-	Broadcast(message)
-	return nil
-}
-
-func handleUserOffline(message Message) error {
-	var userID int
+	if post.Locked {
+		return fmt.Errorf("%w: post %d", errLocked, postID)
+	}
 
-	switch v := message.Content.(type) {
-	case float64:
-		userID = int(v)
-	case int:
-		userID = v
-	case map[string]interface{}:
-		if idValue, exists := v["userId"]; exists {
-			switch id := idValue.(type) {
-			case float64:
-				userID = int(id)
-			case int:
-				userID = id
-			case string:
-				_, err := fmt.Sscanf(id, "%d", &userID)
-				if err != nil {
-					return fmt.Errorf("invalid userId format in user_offline message: %v", id)
-				}
-			default:
-				return fmt.Errorf("invalid userId type in user_offline message: %T", idValue)
-			}
-		} else {
-			return fmt.Errorf("missing userId in user_offline message content")
-		}
-	default:
-		return fmt.Errorf("invalid user_offline message content format: %T", message.Content)
+	result := filter.Check(filter.Content{Kind: filter.KindComment, UserID: message.Sender, Text: commentContent})
+	if result.Rejected {
+		return fmt.Errorf("%w: %s", errRejected, result.Reason)
 	}
+	commentContent = result.Text
+	content["content"] = commentContent
+	contentHTML := markup.Render(commentContent)
+	content["contentHtml"] = contentHTML
 
-	if userID <= 0 {
-		return fmt.Errorf("invalid userId value in user_offline message: %d", userID)
+	inserted, err := database.DB.Exec(
+		"INSERT INTO comments (post_id, user_id, content, content_html) VALUES (?, ?, ?, ?)",
+		postID, message.Sender, commentContent, contentHTML,
+	)
+	if err != nil {
+		return fmt.Errorf("database error saving comment: %w", err)
+	}
+	commentID, err := inserted.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("database error saving comment: %w", err)
 	}
 
-	onlineUsersMutex.Lock()
-	delete(onlineUsers, userID)
-	onlineUsersMutex.Unlock()
-	log.Printf("User %d is now offline", userID)
+	content["id"] = commentID
+	content["postId"] = postID
+	message.Content = content
 
-	Broadcast(message)
+	SendToPost(postID, message)
+	ClearDraft(message.Sender, models.CommentDraft(postID))
+
+	if err := models.Follow(message.Sender, models.FollowPost, postID); err != nil {
+		log.Printf("Failed to follow post %d for commenter %d: %v", postID, message.Sender, err)
+	}
+
+	mentioned := NotifyMentions(models.Mention{
+		AuthorID:   message.Sender,
+		AuthorName: sender.Nickname,
+		SourceType: models.TargetComment,
+		SourceID:   int(commentID),
+		PostID:     postID,
+	}, markup.Mentions(commentContent), commentContent)
+	NotifyNewComment(post, models.Comment{
+		ID:      int(commentID),
+		PostID:  postID,
+		UserID:  message.Sender,
+		Content: commentContent,
+	}, sender.Nickname, mentioned)
 	return nil
 }
 
-func handleTypingStart(message Message) error {
+func (c *Client) handleTypingStart(message Message) error {
 	content, ok := message.Content.(map[string]interface{})
 	if !ok {
 		return fmt.Errorf("invalid typing_start content format: expected map[string]interface{}, got %T", message.Content)
@@ -462,30 +534,23 @@ func handleTypingStart(message Message) error {
 	}
 
 	// Check if receiver is online
-	onlineUsersMutex.Lock()
-	isReceiverOnline := onlineUsers[receiverID]
-	onlineUsersMutex.Unlock()
-
-	if !isReceiverOnline {
+	if !IsUserOnline(receiverID) {
 		return fmt.Errorf("receiver is not online")
 	}
 
-	var senderName string
-	senderUser, err := models.GetUserByID(message.Sender)
-	if err == nil {
-		senderName = senderUser.Nickname
-	} else {
-		senderName = fmt.Sprintf("User %d", message.Sender)
+	blocked, err := models.IsBlockedBetween(c.userID, receiverID)
+	if err != nil {
+		return fmt.Errorf("failed to check blocks: %w", err)
+	}
+	if blocked {
+		return errBlocked
 	}
 
-	content["senderName"] = senderName
-	message.Content = content
-
-	Broadcast(message)
+	c.hub.StartTyping(c.userID, receiverID, c.displayName())
 	return nil
 }
 
-func handleTypingStop(message Message) error {
+func (c *Client) handleTypingStop(message Message) error {
 	content, ok := message.Content.(map[string]interface{})
 	if !ok {
 		return fmt.Errorf("invalid typing_stop content format: expected map[string]interface{}, got %T", message.Content)
@@ -516,33 +581,39 @@ func handleTypingStop(message Message) error {
 		return fmt.Errorf("invalid receiverId value: %d", receiverID)
 	}
 
-	Broadcast(message)
+	c.hub.StopTyping(c.userID, receiverID)
 	return nil
 }
 
-func DisconnectUser(userID int) {
-	clientsMutex.Lock()
-	defer clientsMutex.Unlock()
-
-	var clientToDisconnect *Client
-	for client := range clients {
-		if client.userID == userID {
-			clientToDisconnect = client
-			break
+// displayName returns the sender's nickname, loading it on first use.
+func (c *Client) displayName() string {
+	if c.name == "" {
+		user, err := models.GetUserByID(c.userID)
+		if err != nil {
+			return fmt.Sprintf("User %d", c.userID)
 		}
+		c.name = user.Nickname
 	}
+	return c.name
+}
 
-	if clientToDisconnect != nil {
-		if err := clientToDisconnect.conn.Close(); err != nil {
-			log.Printf("Error closing connection for user %d: %v", userID, err)
-		}
-
-		delete(clients, clientToDisconnect)
+// handleSetStatus stores and announces the presence status the user chose,
+// sent as {"type": "set_status", "content": {"status": "away"}}.
+func (c *Client) handleSetStatus(message Message) error {
+	content, ok := message.Content.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid set_status content format: expected map[string]interface{}, got %T", message.Content)
+	}
 
-		onlineUsersMutex.Lock()
-		delete(onlineUsers, userID)
-		onlineUsersMutex.Unlock()
+	status, _ := content["status"].(string)
+	if !models.IsValidPresence(status) {
+		return fmt.Errorf("invalid status %q", status)
+	}
 
-		log.Printf("User %d forcibly disconnected", userID)
+	if err := models.SetUserPresence(c.userID, status); err != nil {
+		return fmt.Errorf("failed to save status: %w", err)
 	}
+
+	c.hub.SetStatus(c.userID, status)
+	return nil
 }
@@ -0,0 +1,286 @@
+package websocket
+
+import (
+	"RTF/internal/config"
+	"RTF/internal/pubsub"
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	gorillaWs "github.com/gorilla/websocket"
+)
+
+// clusterTopic carries every event that must reach clients connected to
+// other forum instances.
+const clusterTopic = "rtf:events"
+
+const (
+	eventDeliver    = "deliver"
+	eventPresence   = "presence"
+	eventDisconnect = "disconnect"
+	eventViewers    = "viewers"
+	eventSession    = "session"
+)
+
+type clusterEvent struct {
+	Origin   string         `json:"origin"`
+	Kind     string         `json:"kind"`
+	Target   *Target        `json:"target,omitempty"`
+	Message  *Message       `json:"message,omitempty"`
+	Users    []int          `json:"users,omitempty"`
+	Statuses map[int]string `json:"statuses,omitempty"`
+	Rooms    map[string]int `json:"rooms,omitempty"`
+	UserID   int            `json:"userId,omitempty"`
+	Room     string         `json:"room,omitempty"`
+	Count    int            `json:"count,omitempty"`
+	Code     int            `json:"code,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+	// Session and NewSession are session keys, never session IDs.
+	Session    string `json:"session,omitempty"`
+	NewSession string `json:"newSession,omitempty"`
+	// Replaced marks a disconnect caused by the user connecting through
+	// the instance that sent it.
+	Replaced bool `json:"replaced,omitempty"`
+}
+
+// outboxSize is how many cluster events can wait for the broker before new
+// ones are dropped.
+const outboxSize = 1024
+
+// outgoing is a marshaled cluster event waiting to be published. One with
+// a flushed channel instead marks a point in the queue: the relay closes
+// the channel once everything before it was published.
+type outgoing struct {
+	kind    string
+	payload []byte
+	flushed chan struct{}
+}
+
+type presenceSnapshot struct {
+	users    map[int]bool
+	statuses map[int]string
+	seen     time.Time
+}
+
+var (
+	bus        pubsub.PubSub
+	instanceID string
+
+	// outbox holds the events relayLoop publishes, so that a slow or hung
+	// broker never blocks the hub or a request.
+	outbox = make(chan outgoing, outboxSize)
+
+	// remotePresence holds the last presence snapshot announced by every
+	// other instance. Snapshots that stop being refreshed expire, so users
+	// of a crashed instance eventually show as offline.
+	remotePresence      = make(map[string]presenceSnapshot)
+	remotePresenceMutex sync.Mutex
+)
+
+func publishEvent(event clusterEvent) {
+	if bus == nil {
+		return
+	}
+
+	event.Origin = instanceID
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling %s cluster event: %v", event.Kind, err)
+		return
+	}
+
+	select {
+	case outbox <- outgoing{kind: event.Kind, payload: payload}:
+	default:
+		log.Printf("Cluster event queue full, dropping %s event", event.Kind)
+	}
+}
+
+// relayLoop publishes the queued cluster events in order.
+func relayLoop() {
+	for event := range outbox {
+		if event.flushed != nil {
+			close(event.flushed)
+			continue
+		}
+		if err := bus.Publish(clusterTopic, event.payload); err != nil {
+			log.Printf("Error publishing %s cluster event: %v", event.kind, err)
+		}
+	}
+}
+
+// flushEvents waits until the events queued so far were published or ctx
+// expires.
+func flushEvents(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case outbox <- outgoing{flushed: flushed}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func handleClusterEvent(payload []byte) {
+	var event clusterEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Printf("Invalid cluster event: %v", err)
+		return
+	}
+
+	// Local clients were served before the event was published.
+	if event.Origin == instanceID {
+		return
+	}
+
+	if event.Kind == eventPresence {
+		users := make(map[int]bool, len(event.Users))
+		for _, userID := range event.Users {
+			users[userID] = true
+		}
+
+		remotePresenceMutex.Lock()
+		if len(users) == 0 {
+			delete(remotePresence, event.Origin)
+		} else {
+			remotePresence[event.Origin] = presenceSnapshot{users: users, statuses: event.Statuses, seen: time.Now()}
+		}
+		remotePresenceMutex.Unlock()
+	}
+
+	hub.applyClusterEvent(event)
+}
+
+// applyClusterEvent applies an event from another instance to the clients
+// of h.
+func (h *Hub) applyClusterEvent(event clusterEvent) {
+	switch event.Kind {
+	case eventDeliver:
+		if event.Message != nil && event.Target != nil {
+			h.Send(*event.Target, *event.Message)
+		}
+	case eventPresence:
+		h.ReplaceRemoteViewers(event.Origin, event.Rooms)
+	case eventViewers:
+		h.SetRemoteViewers(event.Origin, event.Room, event.Count)
+	case eventDisconnect:
+		if event.Replaced {
+			h.ReplaceUser(event.UserID)
+			return
+		}
+		if event.Code == 0 {
+			event.Code, event.Reason = gorillaWs.CloseNormalClosure, "disconnected"
+		}
+		if event.Session != "" {
+			h.DisconnectSession(event.UserID, event.Session, event.Code, event.Reason)
+		} else {
+			h.DisconnectUser(event.UserID, event.Code, event.Reason)
+		}
+	case eventSession:
+		h.RenameSession(event.UserID, event.Session, event.NewSession)
+	default:
+		log.Printf("Unknown cluster event kind '%s' from %s", event.Kind, event.Origin)
+	}
+}
+
+// announcePresence publishes the full set of users connected to this
+// instance, their visible statuses and its room counts. Sending the whole
+// set rather than deltas lets a restarted instance converge without any
+// replay.
+func announcePresence() {
+	publishEvent(presenceEvent(hub.currentSnapshot()))
+}
+
+func presenceEvent(snapshot hubSnapshot) clusterEvent {
+	return clusterEvent{
+		Kind:     eventPresence,
+		Users:    snapshot.users,
+		Statuses: snapshot.statuses,
+		Rooms:    snapshot.rooms,
+	}
+}
+
+func presenceLoop() {
+	interval := config.Get().PresenceInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			announcePresence()
+
+			var expired []string
+			remotePresenceMutex.Lock()
+			for origin, snapshot := range remotePresence {
+				if time.Since(snapshot.seen) > 3*interval {
+					delete(remotePresence, origin)
+					expired = append(expired, origin)
+				}
+			}
+			remotePresenceMutex.Unlock()
+
+			for _, origin := range expired {
+				hub.ReplaceRemoteViewers(origin, nil)
+			}
+		case <-hub.stopped:
+			return
+		}
+	}
+}
+
+// GetPresence returns the visible status of every user connected to any
+// instance. Invisible users are left out.
+func GetPresence() map[int]string {
+	statuses := make(map[int]string)
+
+	remotePresenceMutex.Lock()
+	for _, snapshot := range remotePresence {
+		for userID, status := range snapshot.statuses {
+			statuses[userID] = status
+		}
+	}
+	remotePresenceMutex.Unlock()
+
+	for userID, status := range hub.Presence() {
+		statuses[userID] = status
+	}
+	return statuses
+}
+
+// GetOnlineUsers returns the users other users can see online on any
+// instance.
+func GetOnlineUsers() []int {
+	statuses := GetPresence()
+	users := make([]int, 0, len(statuses))
+	for userID := range statuses {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// IsUserOnline reports whether userID is connected to any instance, whatever
+// status they show.
+func IsUserOnline(userID int) bool {
+	if hub.IsOnline(userID) {
+		return true
+	}
+
+	remotePresenceMutex.Lock()
+	defer remotePresenceMutex.Unlock()
+
+	for _, snapshot := range remotePresence {
+		if snapshot.users[userID] {
+			return true
+		}
+	}
+	return false
+}
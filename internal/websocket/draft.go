@@ -0,0 +1,40 @@
+package websocket
+
+import (
+	"RTF/internal/models"
+	"log"
+)
+
+// ClearDraft removes the draft userID kept in context once what it held has
+// been sent, and tells their other devices to empty the field. Errors are
+// only logged.
+func ClearDraft(userID int, context string) {
+	err := models.DeleteDraft(userID, context)
+	if err == models.ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to clear draft %s of user %d: %v", context, userID, err)
+		return
+	}
+	SendDraftDeleted(userID, context)
+}
+
+// SendDraftUpdated syncs a saved draft to all of its author's connections.
+func SendDraftUpdated(userID int, draft models.Draft) {
+	SendToUser(userID, Message{
+		Type: "draft_updated",
+		Content: map[string]interface{}{
+			"draft": draft,
+		},
+	})
+}
+
+func SendDraftDeleted(userID int, context string) {
+	SendToUser(userID, Message{
+		Type: "draft_deleted",
+		Content: map[string]interface{}{
+			"context": context,
+		},
+	})
+}
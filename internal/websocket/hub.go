@@ -0,0 +1,646 @@
+package websocket
+
+import (
+	"RTF/internal/config"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	gorillaWs "github.com/gorilla/websocket"
+)
+
+// Hub owns the set of connected clients. All of its state is read and
+// written by the goroutine running Run; other goroutines talk to it through
+// channels, so there are no locks to order and a client's send channel is
+// closed exactly once, by the hub.
+type Hub struct {
+	clients map[*Client]bool
+	users   map[int]map[*Client]bool
+	rooms   map[string]map[*Client]bool
+
+	// remoteViewers holds, per instance, how many of its clients are in
+	// each room, so viewer counts cover the whole cluster.
+	remoteViewers map[string]map[string]int
+	// closing suppresses viewer updates while Shutdown empties the rooms.
+	closing bool
+
+	// presence holds the status of each connected user.
+	presence    map[int]*userPresence
+	idleTimeout time.Duration
+
+	// typing holds when each active typing indicator expires.
+	typing        map[typingKey]time.Time
+	typingTimeout time.Duration
+
+	register   chan *Client
+	unregister chan *Client
+	deliveries chan delivery
+	membership chan membershipChange
+	disconnect chan disconnectRequest
+	query      chan func()
+
+	typingChanges chan typingChange
+	activity      chan int
+
+	shutdown chan chan []*Client
+	stopped  chan struct{}
+
+	// onPublish, onPresence and onViewers, when set, are called from the
+	// hub goroutine for events the hub generates itself, so that they can be
+	// relayed to other instances. onOffline is called when a visible user's
+	// last connection closes. None of them may call back into the hub or
+	// block.
+	onPublish  func(Target, Message)
+	onPresence func(hubSnapshot)
+	onViewers  func(room string, local int)
+	onOffline  func(userID int, at time.Time)
+}
+
+type delivery struct {
+	target  Target
+	message Message
+}
+
+type membershipChange struct {
+	client *Client
+	room   string
+	join   bool
+}
+
+// disconnectRequest closes the connections of userID, or with a session
+// only those opened with it. A replaced request comes from the user
+// connecting again through another instance.
+type disconnectRequest struct {
+	userID   int
+	session  string
+	code     int
+	reason   string
+	replaced bool
+}
+
+// replacedReason closes a connection superseded by a newer one of the same
+// user.
+const replacedReason = "connected from another session"
+
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[*Client]bool),
+		users:   make(map[int]map[*Client]bool),
+		rooms:   make(map[string]map[*Client]bool),
+
+		remoteViewers: make(map[string]map[string]int),
+		presence:      make(map[int]*userPresence),
+		typing:        make(map[typingKey]time.Time),
+		typingChanges: make(chan typingChange, 64),
+		activity:      make(chan int, 64),
+		register:      make(chan *Client),
+		unregister:    make(chan *Client),
+		deliveries:    make(chan delivery, 256),
+		membership:    make(chan membershipChange),
+		disconnect:    make(chan disconnectRequest),
+		query:         make(chan func()),
+		shutdown:      make(chan chan []*Client),
+		stopped:       make(chan struct{}),
+	}
+}
+
+func (h *Hub) Run() {
+	defer close(h.stopped)
+
+	h.typingTimeout = config.Get().TypingTimeout
+	h.idleTimeout = config.Get().IdleTimeout
+	housekeeping := time.NewTicker(time.Second)
+	defer housekeeping.Stop()
+
+	for {
+		select {
+		case client := <-h.register:
+			h.add(client)
+		case client := <-h.unregister:
+			h.remove(client, gorillaWs.CloseGoingAway, "")
+		case d := <-h.deliveries:
+			h.route(d.target, d.message)
+		case change := <-h.membership:
+			if change.join {
+				h.join(change.client, change.room)
+			} else {
+				h.leave(change.client, change.room)
+			}
+		case request := <-h.disconnect:
+			for client := range h.users[request.userID] {
+				switch {
+				case request.replaced:
+					h.replace(client)
+				case request.session == "" || client.session == request.session:
+					h.remove(client, request.code, request.reason)
+				}
+			}
+		case change := <-h.typingChanges:
+			h.applyTyping(change, time.Now())
+		case userID := <-h.activity:
+			h.updatePresence(userID, func(p *userPresence) {
+				p.lastActive = time.Now()
+				p.idle = false
+			})
+		case now := <-housekeeping.C:
+			h.expireTyping(now)
+			h.markIdle(now)
+		case fn := <-h.query:
+			fn()
+		case reply := <-h.shutdown:
+			reply <- h.closeAll()
+			return
+		}
+	}
+}
+
+// Connect registers a client for conn with the presence status the user
+// chose and starts its pumps. Any existing connection of the same user on
+// this hub is replaced. It returns nil if the hub has stopped.
+func (h *Hub) Connect(conn *gorillaWs.Conn, userID int, session, status string) *Client {
+	client := &Client{
+		hub:     h,
+		conn:    conn,
+		send:    make(chan []byte, 256),
+		userID:  userID,
+		session: session,
+		status:  status,
+		done:    make(chan struct{}),
+		rooms:   make(map[string]bool),
+
+		typingLimit: newRateLimiter(config.Get().TypingRate),
+	}
+
+	select {
+	case h.register <- client:
+	case <-h.stopped:
+		conn.WriteControl(gorillaWs.CloseMessage,
+			gorillaWs.FormatCloseMessage(gorillaWs.CloseServiceRestart, "server shutting down"),
+			time.Now().Add(time.Second))
+		conn.Close()
+		return nil
+	}
+
+	go client.readPump()
+	go client.writePump()
+	return client
+}
+
+// Send delivers message to the clients of this hub matched by target.
+func (h *Hub) Send(target Target, message Message) {
+	select {
+	case h.deliveries <- delivery{target: target, message: message}:
+	case <-h.stopped:
+	}
+}
+
+// Broadcast delivers message to every client of this hub.
+func (h *Hub) Broadcast(message Message) {
+	h.Send(ToAll(), message)
+}
+
+// SendToUser delivers message to every connection userID has on this hub.
+func (h *Hub) SendToUser(userID int, message Message) {
+	h.Send(ToUser(userID), message)
+}
+
+// Join subscribes client to room.
+func (h *Hub) Join(client *Client, room string) {
+	h.changeMembership(membershipChange{client: client, room: room, join: true})
+}
+
+// Leave unsubscribes client from room.
+func (h *Hub) Leave(client *Client, room string) {
+	h.changeMembership(membershipChange{client: client, room: room})
+}
+
+func (h *Hub) changeMembership(change membershipChange) {
+	select {
+	case h.membership <- change:
+	case <-h.stopped:
+	}
+}
+
+// SetRemoteViewers records that instance origin has count clients in room
+// and pushes the new total to the room.
+func (h *Hub) SetRemoteViewers(origin, room string, count int) {
+	h.do(func() {
+		if count == 0 {
+			delete(h.remoteViewers[origin], room)
+		} else {
+			if h.remoteViewers[origin] == nil {
+				h.remoteViewers[origin] = make(map[string]int)
+			}
+			h.remoteViewers[origin][room] = count
+		}
+		h.pushViewers(room)
+	})
+}
+
+// ReplaceRemoteViewers replaces all room counts of instance origin, e.g.
+// from a presence snapshot. A nil rooms forgets the instance.
+func (h *Hub) ReplaceRemoteViewers(origin string, rooms map[string]int) {
+	h.do(func() {
+		previous := h.remoteViewers[origin]
+		if len(rooms) == 0 {
+			delete(h.remoteViewers, origin)
+		} else {
+			h.remoteViewers[origin] = rooms
+		}
+
+		for room, count := range previous {
+			if rooms[room] != count {
+				h.pushViewers(room)
+			}
+		}
+		for room := range rooms {
+			if _, seen := previous[room]; !seen {
+				h.pushViewers(room)
+			}
+		}
+	})
+}
+
+// Viewers returns the number of clients in room across the cluster.
+func (h *Hub) Viewers(room string) int {
+	count := 0
+	h.do(func() { count = h.viewers(room) })
+	return count
+}
+
+// DisconnectUser closes userID's connections with the given close code and
+// reason.
+func (h *Hub) DisconnectUser(userID int, code int, reason string) {
+	select {
+	case h.disconnect <- disconnectRequest{userID: userID, code: code, reason: reason}:
+	case <-h.stopped:
+	}
+}
+
+// ReplaceUser closes userID's connections because they connected again
+// through another instance. That instance announces them, so they are not
+// shown as offline in between.
+func (h *Hub) ReplaceUser(userID int) {
+	select {
+	case h.disconnect <- disconnectRequest{userID: userID, replaced: true}:
+	case <-h.stopped:
+	}
+}
+
+// DisconnectSession closes userID's connections opened with session.
+func (h *Hub) DisconnectSession(userID int, session string, code int, reason string) {
+	if session == "" {
+		return
+	}
+	select {
+	case h.disconnect <- disconnectRequest{userID: userID, session: session, code: code, reason: reason}:
+	case <-h.stopped:
+	}
+}
+
+// RenameSession moves userID's connections opened with session from to
+// session to, e.g. when the session ID is rotated.
+func (h *Hub) RenameSession(userID int, from, to string) {
+	h.do(func() {
+		for client := range h.users[userID] {
+			if client.session == from {
+				client.session = to
+			}
+		}
+	})
+}
+
+// do runs fn on the hub goroutine and waits for it. It reports false if the
+// hub has stopped.
+func (h *Hub) do(fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case h.query <- func() { fn(); close(done) }:
+		<-done
+		return true
+	case <-h.stopped:
+		return false
+	}
+}
+
+func (h *Hub) OnlineUsers() []int {
+	var users []int
+	h.do(func() { users = h.onlineUserIDs() })
+	return users
+}
+
+func (h *Hub) IsOnline(userID int) bool {
+	online := false
+	h.do(func() { online = len(h.users[userID]) > 0 })
+	return online
+}
+
+func (h *Hub) ClientCount() int {
+	count := 0
+	h.do(func() { count = len(h.clients) })
+	return count
+}
+
+// Shutdown sends every client a server_shutdown frame, closes their
+// connections once pending writes are flushed and stops the hub. It waits
+// for the write pumps until ctx expires.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	reply := make(chan []*Client, 1)
+	select {
+	case h.shutdown <- reply:
+	case <-h.stopped:
+		return nil
+	}
+	pending := <-reply
+
+	log.Printf("Shutting down WebSocket hub, draining %d clients", len(pending))
+
+	for _, client := range pending {
+		select {
+		case <-client.done:
+		case <-ctx.Done():
+			for _, c := range pending {
+				c.conn.Close()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (h *Hub) onlineUserIDs() []int {
+	users := make([]int, 0, len(h.users))
+	for userID := range h.users {
+		users = append(users, userID)
+	}
+	return users
+}
+
+func (h *Hub) add(client *Client) {
+	// One connection per user: a new login replaces the old socket without
+	// announcing the user as offline in between.
+	for existing := range h.users[client.userID] {
+		h.detach(existing, gorillaWs.CloseGoingAway, replacedReason)
+	}
+
+	h.clients[client] = true
+	if h.users[client.userID] == nil {
+		h.users[client.userID] = make(map[*Client]bool)
+	}
+	h.users[client.userID][client] = true
+
+	log.Printf("User %d connected. Total connected clients: %d", client.userID, len(h.clients))
+
+	p := h.presence[client.userID]
+	before := ""
+	if p != nil {
+		before = p.visible()
+	} else {
+		p = &userPresence{}
+		h.presence[client.userID] = p
+	}
+	p.status = client.status
+	p.idle = false
+	p.lastActive = time.Now()
+
+	h.announceStatus(client.userID, before, p.visible(), time.Time{})
+	h.publishSnapshot()
+}
+
+// detach removes client and closes its send channel; writePump then flushes
+// what is queued and sends a close frame. It is a no-op for clients that
+// were already removed.
+func (h *Hub) detach(client *Client, code int, reason string) bool {
+	if !h.clients[client] {
+		return false
+	}
+
+	delete(h.clients, client)
+	delete(h.users[client.userID], client)
+	if len(h.users[client.userID]) == 0 {
+		delete(h.users, client.userID)
+	}
+	for room := range client.rooms {
+		h.leave(client, room)
+	}
+
+	client.closeCode = code
+	client.closeReason = reason
+	close(client.send)
+	return true
+}
+
+func (h *Hub) remove(client *Client, code int, reason string) {
+	if !h.detach(client, code, reason) {
+		return
+	}
+
+	log.Printf("User %d disconnected. Remaining connected clients: %d", client.userID, len(h.clients))
+
+	if len(h.users[client.userID]) == 0 {
+		h.stopTypingFrom(client.userID)
+
+		before := h.presence[client.userID].visible()
+		delete(h.presence, client.userID)
+
+		// Invisible users keep their previous last-seen time, which
+		// would otherwise reveal that they were around.
+		var lastSeen time.Time
+		if before != "" {
+			lastSeen = time.Now()
+			if h.onOffline != nil {
+				h.onOffline(client.userID, lastSeen)
+			}
+		}
+		h.announceStatus(client.userID, before, "", lastSeen)
+		h.publishSnapshot()
+	}
+}
+
+// replace closes client for ReplaceUser. Unlike remove it neither announces
+// the user as offline nor records when they were last seen.
+func (h *Hub) replace(client *Client) {
+	if !h.detach(client, gorillaWs.CloseGoingAway, replacedReason) {
+		return
+	}
+
+	if len(h.users[client.userID]) == 0 {
+		h.stopTypingFrom(client.userID)
+		delete(h.presence, client.userID)
+		h.publishSnapshot()
+	}
+}
+
+// emit delivers an event generated by the hub to every client.
+func (h *Hub) emit(message Message) {
+	h.emitTo(ToAll(), message)
+}
+
+// emitTo delivers an event generated by the hub to the local clients
+// matched by target and hands it to onPublish.
+func (h *Hub) emitTo(target Target, message Message) {
+	h.route(target, message)
+	if h.onPublish != nil {
+		h.onPublish(target, message)
+	}
+}
+
+func (h *Hub) encode(message Message) ([]byte, bool) {
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error marshaling message of type '%s': %v", message.Type, err)
+		return nil, false
+	}
+	return messageJSON, true
+}
+
+// deliver queues a frame for client, dropping clients whose buffer is full
+// rather than letting one slow reader stall the hub.
+func (h *Hub) deliver(client *Client, frame []byte) bool {
+	select {
+	case client.send <- frame:
+		return true
+	default:
+		log.Printf("Failed to send message to user %d, closing connection", client.userID)
+		h.remove(client, gorillaWs.ClosePolicyViolation, "too slow")
+		return false
+	}
+}
+
+func (h *Hub) join(client *Client, room string) {
+	if !h.clients[client] || client.rooms[room] {
+		return
+	}
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]bool)
+	}
+	h.rooms[room][client] = true
+	client.rooms[room] = true
+	h.roomChanged(room)
+}
+
+func (h *Hub) leave(client *Client, room string) {
+	if !client.rooms[room] {
+		return
+	}
+	delete(client.rooms, room)
+	delete(h.rooms[room], client)
+	if len(h.rooms[room]) == 0 {
+		delete(h.rooms, room)
+	}
+	h.roomChanged(room)
+}
+
+func (h *Hub) roomChanged(room string) {
+	if h.closing {
+		return
+	}
+	h.pushViewers(room)
+	if h.onViewers != nil {
+		h.onViewers(room, len(h.rooms[room]))
+	}
+}
+
+func (h *Hub) roomCounts() map[string]int {
+	rooms := make(map[string]int, len(h.rooms))
+	for room, clients := range h.rooms {
+		rooms[room] = len(clients)
+	}
+	return rooms
+}
+
+func (h *Hub) viewers(room string) int {
+	count := len(h.rooms[room])
+	for _, rooms := range h.remoteViewers {
+		count += rooms[room]
+	}
+	return count
+}
+
+// pushViewers tells the clients in room how many viewers it has. Only post
+// rooms show a count; the feed and category rooms are too busy to announce
+// every client coming and going.
+func (h *Hub) pushViewers(room string) {
+	if !strings.HasPrefix(room, postTopicPrefix) || len(h.rooms[room]) == 0 {
+		return
+	}
+	h.route(ToRoom(room), Message{
+		Type: "viewers",
+		Content: map[string]interface{}{
+			"topic": room,
+			"count": h.viewers(room),
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// recipients resolves target to the clients of this hub it matches.
+func (h *Hub) recipients(target Target) map[*Client]bool {
+	switch {
+	case target.client != nil:
+		if h.clients[target.client] {
+			return map[*Client]bool{target.client: true}
+		}
+		return nil
+	case target.All:
+		return h.clients
+	case target.Room != "":
+		return h.rooms[target.Room]
+	}
+
+	matched := make(map[*Client]bool)
+	for _, userID := range target.Users {
+		for client := range h.users[userID] {
+			matched[client] = true
+		}
+	}
+	return matched
+}
+
+func (h *Hub) route(target Target, message Message) {
+	frame, ok := h.encode(message)
+	if !ok {
+		return
+	}
+
+	sentCount := 0
+	failedCount := 0
+	for client := range h.recipients(target) {
+		if h.deliver(client, frame) {
+			sentCount++
+		} else {
+			failedCount++
+		}
+	}
+
+	if message.Type != "pong" && message.Type != "viewers" {
+		log.Printf("Sent message type '%s' to %d clients (%d failed)",
+			message.Type, sentCount, failedCount)
+	}
+}
+
+func (h *Hub) closeAll() []*Client {
+	h.closing = true
+
+	frame, _ := h.encode(Message{
+		Type: "server_shutdown",
+		Content: map[string]interface{}{
+			"reconnectAfterMs": config.Get().ReconnectHint.Milliseconds(),
+		},
+		Timestamp: time.Now(),
+	})
+
+	pending := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		select {
+		case client.send <- frame:
+		default:
+			log.Printf("Send buffer full for user %d, closing without shutdown frame", client.userID)
+		}
+		h.detach(client, gorillaWs.CloseServiceRestart, "server shutting down")
+		pending = append(pending, client)
+	}
+	return pending
+}
@@ -0,0 +1,699 @@
+package websocket
+
+import (
+	"RTF/internal/models"
+	"RTF/internal/pubsub"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	gorillaWs "github.com/gorilla/websocket"
+)
+
+// newTestHub starts a hub and an HTTP server that connects every request to
+// it as the user named by the "user" query parameter.
+func newTestHub(t *testing.T) (*Hub, string) {
+	t.Helper()
+
+	h := NewHub()
+	go h.Run()
+
+	upgrader := gorillaWs.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(r.URL.Query().Get("user"))
+		if err != nil {
+			http.Error(w, "bad user", http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		h.Connect(conn, userID, r.URL.Query().Get("session"), models.StatusOnline)
+	}))
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		h.Shutdown(ctx)
+		server.Close()
+	})
+	return h, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, url string, userID int) *gorillaWs.Conn {
+	t.Helper()
+
+	conn, _, err := gorillaWs.DefaultDialer.Dial(url+"?user="+strconv.Itoa(userID), nil)
+	if err != nil {
+		t.Fatalf("dial user %d: %v", userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readUntil reads frames until one of type want arrives and returns the
+// types of the frames skipped on the way.
+func readUntil(t *testing.T, conn *gorillaWs.Conn, want string) []string {
+	t.Helper()
+
+	var skipped []string
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for %q: %v", want, err)
+		}
+		if message.Type == want {
+			return skipped
+		}
+		skipped = append(skipped, message.Type)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHubConnectDisconnectStorm(t *testing.T) {
+	h, url := newTestHub(t)
+
+	stop := make(chan struct{})
+	var background sync.WaitGroup
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				h.Broadcast(Message{Type: "storm"})
+				h.SendToUser(3, Message{Type: "direct"})
+				h.OnlineUsers()
+				h.IsOnline(7)
+			}
+		}
+	}()
+
+	var storm sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		storm.Add(1)
+		go func(i int) {
+			defer storm.Done()
+			for j := 0; j < 5; j++ {
+				conn, _, err := gorillaWs.DefaultDialer.Dial(url+"?user="+strconv.Itoa(i%10+1), nil)
+				if err != nil {
+					t.Errorf("dial: %v", err)
+					return
+				}
+				if j%2 == 0 {
+					conn.WriteMessage(gorillaWs.CloseMessage,
+						gorillaWs.FormatCloseMessage(gorillaWs.CloseNormalClosure, ""))
+				}
+				conn.Close()
+			}
+		}(i)
+	}
+	storm.Wait()
+	close(stop)
+	background.Wait()
+
+	waitFor(t, "all clients to unregister", func() bool {
+		return h.ClientCount() == 0 && len(h.OnlineUsers()) == 0
+	})
+}
+
+func TestHubSendToUser(t *testing.T) {
+	h, url := newTestHub(t)
+
+	alice := dial(t, url, 1)
+	bob := dial(t, url, 2)
+	waitFor(t, "both users online", func() bool { return len(h.OnlineUsers()) == 2 })
+
+	h.SendToUser(2, Message{Type: "direct", Content: "hi bob"})
+	h.Broadcast(Message{Type: "marker"})
+
+	if skipped := readUntil(t, bob, "direct"); len(skipped) > 2 {
+		t.Fatalf("bob got unexpected frames before the direct message: %v", skipped)
+	}
+	for _, typ := range readUntil(t, alice, "marker") {
+		if typ == "direct" {
+			t.Fatal("alice received a message addressed to bob")
+		}
+	}
+}
+
+func TestHubReplacesExistingConnection(t *testing.T) {
+	h, url := newTestHub(t)
+
+	observer := dial(t, url, 2)
+	first := dial(t, url, 1)
+	waitFor(t, "first connection", func() bool { return h.IsOnline(1) })
+
+	second := dial(t, url, 1)
+
+	first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := first.ReadMessage(); err != nil {
+			if !gorillaWs.IsCloseError(err, gorillaWs.CloseGoingAway) {
+				t.Fatalf("expected going-away close on replaced connection, got %v", err)
+			}
+			break
+		}
+	}
+
+	h.Broadcast(Message{Type: "marker"})
+	readUntil(t, second, "marker")
+	for _, typ := range readUntil(t, observer, "marker") {
+		if typ == "user_offline" {
+			t.Fatal("replacing a connection announced the user as offline")
+		}
+	}
+	if count := h.ClientCount(); count != 2 {
+		t.Fatalf("expected 2 clients after replacement, got %d", count)
+	}
+}
+
+func TestHubDisconnectUserSendsReason(t *testing.T) {
+	h, url := newTestHub(t)
+
+	conn := dial(t, url, 1)
+	waitFor(t, "user online", func() bool { return h.IsOnline(1) })
+
+	h.DisconnectUser(1, gorillaWs.ClosePolicyViolation, "banned")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		closeErr, ok := err.(*gorillaWs.CloseError)
+		if !ok || closeErr.Code != gorillaWs.ClosePolicyViolation || closeErr.Text != "banned" {
+			t.Fatalf("expected policy-violation close with reason, got %v", err)
+		}
+		break
+	}
+	if h.IsOnline(1) {
+		t.Fatal("user still online after DisconnectUser")
+	}
+}
+
+func TestHubDisconnectSessionFollowsRenames(t *testing.T) {
+	h, url := newTestHub(t)
+
+	conn, _, err := gorillaWs.DefaultDialer.Dial(url+"?user=1&session=a", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitFor(t, "user online", func() bool { return h.IsOnline(1) })
+
+	h.DisconnectSession(1, "b", gorillaWs.CloseNormalClosure, "logged out")
+	h.RenameSession(1, "a", "b")
+	if !h.IsOnline(1) {
+		t.Fatal("logging out another session closed the connection")
+	}
+
+	h.DisconnectSession(1, "b", gorillaWs.CloseNormalClosure, "logged out")
+	waitFor(t, "user offline", func() bool { return !h.IsOnline(1) })
+}
+
+func TestCloseReasonFitsFrame(t *testing.T) {
+	if got := closeReason("banned: spam"); got != "banned: spam" {
+		t.Fatalf("short reason changed to %q", got)
+	}
+
+	long := "banned: " + strings.Repeat("é", 100)
+	got := closeReason(long)
+	if len(got) > 123 || !utf8.ValidString(got) || !strings.HasPrefix(long, got) {
+		t.Fatalf("bad truncation of long reason: %d bytes, %q", len(got), got)
+	}
+}
+
+func TestHubShutdownDrainsClients(t *testing.T) {
+	h, url := newTestHub(t)
+
+	conn := dial(t, url, 1)
+	waitFor(t, "user online", func() bool { return h.IsOnline(1) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var sawShutdown bool
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !gorillaWs.IsCloseError(err, gorillaWs.CloseServiceRestart) {
+				t.Fatalf("expected service-restart close, got %v", err)
+			}
+			break
+		}
+		var message Message
+		if json.Unmarshal(data, &message) == nil && message.Type == "server_shutdown" {
+			sawShutdown = true
+		}
+	}
+	if !sawShutdown {
+		t.Fatal("client did not receive server_shutdown before the close frame")
+	}
+
+	late, _, err := gorillaWs.DefaultDialer.Dial(url+"?user=2", nil)
+	if err != nil {
+		t.Fatalf("dial after shutdown: %v", err)
+	}
+	defer late.Close()
+	late.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := late.ReadMessage(); !gorillaWs.IsCloseError(err, gorillaWs.CloseServiceRestart) {
+		t.Fatalf("expected connection after shutdown to be refused, got %v", err)
+	}
+}
+
+// clientOf returns the connection userID has on h.
+func clientOf(t *testing.T, h *Hub, userID int) *Client {
+	t.Helper()
+
+	var found *Client
+	waitFor(t, "client registration", func() bool {
+		h.do(func() {
+			for client := range h.users[userID] {
+				found = client
+			}
+		})
+		return found != nil
+	})
+	return found
+}
+
+func TestHubRoutesByTarget(t *testing.T) {
+	h, url := newTestHub(t)
+
+	conns := map[int]*gorillaWs.Conn{}
+	for userID := 1; userID <= 3; userID++ {
+		conns[userID] = dial(t, url, userID)
+	}
+	waitFor(t, "all users online", func() bool { return len(h.OnlineUsers()) == 3 })
+	h.Join(clientOf(t, h, 3), "post:7")
+
+	h.Send(ToConversation(1, 2), Message{Type: "conversation"})
+	h.Send(ToRoom("post:7"), Message{Type: "room"})
+	h.Send(toClient(clientOf(t, h, 2)), Message{Type: "reply"})
+	h.Send(Target{}, Message{Type: "nobody"})
+	h.Broadcast(Message{Type: "marker"})
+
+	want := map[int][]string{
+		1: {"conversation"},
+		2: {"conversation", "reply"},
+		3: {"room"},
+	}
+	for userID, conn := range conns {
+		var got []string
+		for _, typ := range readUntil(t, conn, "marker") {
+			if typ != "user_online" && typ != "viewers" {
+				got = append(got, typ)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(want[userID], ",") {
+			t.Errorf("user %d received %v, want %v", userID, got, want[userID])
+		}
+	}
+}
+
+func TestHubLeavesRoomsOnDisconnect(t *testing.T) {
+	h, url := newTestHub(t)
+
+	conn := dial(t, url, 1)
+	h.Join(clientOf(t, h, 1), "post:1")
+	conn.Close()
+
+	waitFor(t, "room to empty", func() bool {
+		empty := false
+		h.do(func() { empty = len(h.rooms) == 0 })
+		return empty
+	})
+}
+
+// readViewers reads frames until a viewers update for room arrives and
+// returns its count.
+func readViewers(t *testing.T, conn *gorillaWs.Conn, room string) int {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var message struct {
+			Type    string          `json:"type"`
+			Content json.RawMessage `json:"content"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for viewers of %s: %v", room, err)
+		}
+		if message.Type != "viewers" {
+			continue
+		}
+
+		var viewers struct {
+			Topic string `json:"topic"`
+			Count int    `json:"count"`
+		}
+		if err := json.Unmarshal(message.Content, &viewers); err != nil {
+			t.Fatalf("invalid viewers content: %v", err)
+		}
+		if viewers.Topic == room {
+			return viewers.Count
+		}
+	}
+}
+
+func TestHubPushesViewerCounts(t *testing.T) {
+	h, url := newTestHub(t)
+
+	var published []int
+	h.do(func() {
+		h.onViewers = func(room string, local int) { published = append(published, local) }
+	})
+
+	alice := dial(t, url, 1)
+	bob := dial(t, url, 2)
+
+	h.Join(clientOf(t, h, 1), "post:1")
+	if count := readViewers(t, alice, "post:1"); count != 1 {
+		t.Fatalf("expected 1 viewer, got %d", count)
+	}
+
+	h.Join(clientOf(t, h, 2), "post:1")
+	if count := readViewers(t, alice, "post:1"); count != 2 {
+		t.Fatalf("expected 2 viewers, got %d", count)
+	}
+
+	h.SetRemoteViewers("other", "post:1", 3)
+	if count := readViewers(t, alice, "post:1"); count != 5 {
+		t.Fatalf("expected remote viewers to be counted, got %d", count)
+	}
+
+	bob.Close()
+	if count := readViewers(t, alice, "post:1"); count != 4 {
+		t.Fatalf("expected disconnect to leave the room, got %d", count)
+	}
+
+	h.ReplaceRemoteViewers("other", nil)
+	if count := readViewers(t, alice, "post:1"); count != 1 {
+		t.Fatalf("expected dropped instance to stop counting, got %d", count)
+	}
+
+	h.do(func() {
+		if fmt.Sprint(published) != "[1 2 1]" {
+			t.Errorf("published local counts %v, want [1 2 1]", published)
+		}
+	})
+}
+
+func TestHubCountsViewersOfPostRoomsOnly(t *testing.T) {
+	h, url := newTestHub(t)
+
+	conn := dial(t, url, 1)
+	client := clientOf(t, h, 1)
+	h.Join(client, FeedTopic)
+	h.Join(client, CategoryTopic(1))
+	h.Join(client, "post:1")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var message struct {
+			Type    string `json:"type"`
+			Content struct {
+				Topic string `json:"topic"`
+			} `json:"content"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for viewers: %v", err)
+		}
+		if message.Type != "viewers" {
+			continue
+		}
+		if message.Content.Topic != "post:1" {
+			t.Fatalf("got viewers of %s, want only post rooms", message.Content.Topic)
+		}
+		return
+	}
+}
+
+func TestHubTypingIsDeduplicatedAndExpires(t *testing.T) {
+	h, url := newTestHub(t)
+	h.do(func() { h.typingTimeout = 100 * time.Millisecond })
+
+	dial(t, url, 1)
+	bob := dial(t, url, 2)
+	waitFor(t, "both users online", func() bool { return len(h.OnlineUsers()) == 2 })
+
+	h.StartTyping(1, 2, "alice")
+	h.StartTyping(1, 2, "alice")
+
+	skipped := readUntil(t, bob, "typing_stop")
+	starts := 0
+	for _, typ := range skipped {
+		if typ == "typing_start" {
+			starts++
+		}
+	}
+	if starts != 1 {
+		t.Fatalf("expected one typing_start before expiry, got %v", skipped)
+	}
+}
+
+func TestHubTypingStopsOnDisconnect(t *testing.T) {
+	h, url := newTestHub(t)
+
+	alice := dial(t, url, 1)
+	bob := dial(t, url, 2)
+	waitFor(t, "both users online", func() bool { return len(h.OnlineUsers()) == 2 })
+
+	h.StartTyping(1, 2, "alice")
+	readUntil(t, bob, "typing_start")
+
+	alice.Close()
+	for _, typ := range readUntil(t, bob, "typing_stop") {
+		if typ == "user_offline" {
+			t.Fatal("user_offline arrived before typing_stop")
+		}
+	}
+}
+
+func TestRateLimiterAllowsBurstThenRefills(t *testing.T) {
+	limiter := newRateLimiter(4)
+
+	for i := 0; i < 4; i++ {
+		if !limiter.allow() {
+			t.Fatalf("frame %d of the burst was rejected", i+1)
+		}
+	}
+	if limiter.allow() {
+		t.Fatal("frame beyond the burst was allowed")
+	}
+
+	limiter.last = limiter.last.Add(-time.Second)
+	if !limiter.allow() {
+		t.Fatal("limiter did not refill")
+	}
+}
+
+// readPresence reads frames until a presence event of type want about
+// userID arrives and returns its status.
+func readPresence(t *testing.T, conn *gorillaWs.Conn, want string, userID int) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		var message struct {
+			Type    string `json:"type"`
+			Content struct {
+				UserID int    `json:"userId"`
+				Status string `json:"status"`
+			} `json:"content"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for %s of user %d: %v", want, userID, err)
+		}
+		if message.Type == want && message.Content.UserID == userID {
+			return message.Content.Status
+		}
+	}
+}
+
+func TestHubInvisibleUsersAppearOffline(t *testing.T) {
+	h, url := newTestHub(t)
+
+	observer := dial(t, url, 2)
+	waitFor(t, "observer online", func() bool { return h.IsOnline(2) })
+
+	// User 1 connects as online and then switches to invisible.
+	conn, _, err := gorillaWs.DefaultDialer.Dial(url+"?user=1", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	waitFor(t, "user 1 connected", func() bool { return h.IsOnline(1) })
+	h.SetStatus(1, models.StatusInvisible)
+
+	// The first connection announced user 1 as online; going invisible
+	// must look like going offline, without claiming they were just seen.
+	observer.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		var message struct {
+			Type    string                 `json:"type"`
+			Content map[string]interface{} `json:"content"`
+		}
+		if err := observer.ReadJSON(&message); err != nil {
+			t.Fatalf("waiting for user_offline of user 1: %v", err)
+		}
+		if message.Type != "user_offline" {
+			continue
+		}
+		if _, ok := message.Content["lastSeenAt"]; ok {
+			t.Fatalf("going invisible sent a last-seen time: %v", message.Content)
+		}
+		break
+	}
+	if _, visible := h.Presence()[1]; visible {
+		t.Fatal("invisible user listed in presence")
+	}
+	if !h.IsOnline(1) {
+		t.Fatal("invisible user no longer counted as connected")
+	}
+
+	h.SetStatus(1, models.StatusDND)
+	if status := readPresence(t, observer, "user_online", 1); status != models.StatusDND {
+		t.Fatalf("expected user_online with dnd, got %q", status)
+	}
+
+	h.SetStatus(1, models.StatusAway)
+	if status := readPresence(t, observer, "user_status", 1); status != models.StatusAway {
+		t.Fatalf("expected user_status away, got %q", status)
+	}
+}
+
+func TestHubMarksIdleUsersAway(t *testing.T) {
+	h, url := newTestHub(t)
+	h.do(func() { h.idleTimeout = 50 * time.Millisecond })
+
+	observer := dial(t, url, 2)
+	dial(t, url, 1)
+	waitFor(t, "both users online", func() bool { return len(h.OnlineUsers()) == 2 })
+
+	if status := readPresence(t, observer, "user_status", 1); status != models.StatusAway {
+		t.Fatalf("expected idle user to become away, got %q", status)
+	}
+
+	h.Touch(1)
+	if status := readPresence(t, observer, "user_status", 1); status != models.StatusOnline {
+		t.Fatalf("expected activity to bring the user back online, got %q", status)
+	}
+}
+
+// joinBus relays the events of h over bus as instance origin and applies
+// those of other instances to h, as Initialize does for the process hub. It
+// returns a function publishing an event as h's instance.
+func joinBus(t *testing.T, h *Hub, origin string, bus pubsub.PubSub) func(clusterEvent) {
+	t.Helper()
+
+	events := make(chan clusterEvent, 256)
+	publish := func(event clusterEvent) {
+		event.Origin = origin
+		events <- event
+	}
+	go func() {
+		for {
+			select {
+			case event := <-events:
+				payload, _ := json.Marshal(event)
+				bus.Publish(clusterTopic, payload)
+			case <-h.stopped:
+				return
+			}
+		}
+	}()
+
+	h.do(func() {
+		h.onPublish = func(target Target, message Message) {
+			publish(clusterEvent{Kind: eventDeliver, Target: &target, Message: &message})
+		}
+		h.onPresence = func(snapshot hubSnapshot) { publish(presenceEvent(snapshot)) }
+	})
+	bus.Subscribe(clusterTopic, func(payload []byte) {
+		var event clusterEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Errorf("invalid cluster event: %v", err)
+			return
+		}
+		if event.Origin != origin {
+			h.applyClusterEvent(event)
+		}
+	})
+	return publish
+}
+
+func TestHubReconnectThroughAnotherInstanceStaysOnline(t *testing.T) {
+	bus := pubsub.NewMemory()
+	oldHub, oldURL := newTestHub(t)
+	newHub, newURL := newTestHub(t)
+	joinBus(t, oldHub, "old", bus)
+	publishNew := joinBus(t, newHub, "new", bus)
+
+	var offline []int
+	oldHub.do(func() {
+		oldHub.onOffline = func(userID int, at time.Time) { offline = append(offline, userID) }
+	})
+
+	observer := dial(t, oldURL, 2)
+	old := dial(t, oldURL, 1)
+	readPresence(t, observer, "user_online", 1)
+
+	// As HandleConnections does: tell the other instances, then connect.
+	publishNew(clusterEvent{Kind: eventDisconnect, UserID: 1, Replaced: true})
+	dial(t, newURL, 1)
+
+	old.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := old.ReadMessage()
+		if err == nil {
+			continue
+		}
+		closeErr, ok := err.(*gorillaWs.CloseError)
+		if !ok || closeErr.Text != replacedReason {
+			t.Fatalf("expected the old connection to be replaced, got %v", err)
+		}
+		break
+	}
+
+	oldHub.Broadcast(Message{Type: "marker"})
+	for _, typ := range readUntil(t, observer, "marker") {
+		if typ == "user_offline" {
+			t.Fatal("reconnecting through another instance announced the user as offline")
+		}
+	}
+	oldHub.do(func() {
+		if len(offline) != 0 {
+			t.Errorf("last seen time recorded for %v", offline)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"RTF/internal/models"
+	"log"
+	"time"
+)
+
+// NotifyMentions records a mention of each of nicknames by m.AuthorID and
+// returns the mentions stored. Mentioned users who are online get a
+// mention event right away; the others get a notification to find later.
+// Errors are only logged: a failed mention must not fail the content it is
+// in.
+func NotifyMentions(m models.Mention, nicknames []string, text string) []models.Mention {
+	if len(nicknames) == 0 {
+		return nil
+	}
+
+	mentions, err := models.CreateMentions(m, nicknames)
+	if err != nil {
+		log.Printf("Failed to record mentions by user %d in %s %d: %v", m.AuthorID, m.SourceType, m.SourceID, err)
+	}
+	if len(mentions) == 0 {
+		return mentions
+	}
+
+	authorName := m.AuthorName
+	if authorName == "" {
+		if author, err := models.GetUserByID(m.AuthorID); err == nil {
+			authorName = author.Nickname
+		}
+	}
+
+	for _, mention := range mentions {
+		if !IsUserOnline(mention.UserID) {
+			Notify(models.Notification{
+				UserID:     mention.UserID,
+				ActorID:    m.AuthorID,
+				ActorName:  authorName,
+				Type:       models.NotifyMention,
+				SourceType: m.SourceType,
+				SourceID:   m.SourceID,
+				PostID:     m.PostID,
+				Excerpt:    text,
+			})
+			continue
+		}
+		muted, err := models.HasMuted(mention.UserID, m.AuthorID)
+		if err != nil {
+			log.Printf("Failed to check mute of user %d by user %d: %v", m.AuthorID, mention.UserID, err)
+		}
+		if muted {
+			continue
+		}
+
+		mention.AuthorName = authorName
+		SendToUser(mention.UserID, Message{
+			Type: "mention",
+			Content: map[string]interface{}{
+				"mention": mention,
+				"excerpt": excerpt(text),
+			},
+			Sender:    m.AuthorID,
+			Timestamp: time.Now(),
+		})
+	}
+	return mentions
+}
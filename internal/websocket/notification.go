@@ -0,0 +1,151 @@
+package websocket
+
+import (
+	"RTF/internal/models"
+	"log"
+	"time"
+)
+
+// maxExcerpt is how many characters of the text that caused a notification
+// or mention are quoted with it.
+const maxExcerpt = 140
+
+func excerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxExcerpt {
+		return text
+	}
+	return string(runes[:maxExcerpt]) + "…"
+}
+
+// Notify stores n and pushes it to the recipient's connections as a
+// notification event. Nothing is stored when the recipient is the actor,
+// or has blocked or muted them. Errors are only logged: a failed
+// notification must not fail the action that caused it.
+func Notify(n models.Notification) {
+	if n.UserID == n.ActorID {
+		return
+	}
+
+	blocked, err := models.IsBlockedBetween(n.UserID, n.ActorID)
+	if err != nil {
+		log.Printf("Failed to check blocks between users %d and %d: %v", n.UserID, n.ActorID, err)
+		return
+	}
+	muted, err := models.HasMuted(n.UserID, n.ActorID)
+	if err != nil {
+		log.Printf("Failed to check mute of user %d by user %d: %v", n.ActorID, n.UserID, err)
+		return
+	}
+	if blocked || muted {
+		return
+	}
+	deliverNotification(n)
+}
+
+// NotifyWarning stores a moderator's warning over reportID for userID, so
+// that it reaches them even when they are offline, and pushes it along with
+// a warning event to their connections. Unlike Notify it ignores blocks: a
+// user cannot opt out of hearing from the moderators.
+func NotifyWarning(userID int, moderator models.User, reportID int, reason string) {
+	deliverNotification(models.Notification{
+		UserID:     userID,
+		ActorID:    moderator.ID,
+		ActorName:  moderator.Nickname,
+		Type:       models.NotifyWarning,
+		SourceType: "report",
+		SourceID:   reportID,
+		Excerpt:    reason,
+	})
+
+	SendToUser(userID, Message{
+		Type: "warning",
+		Content: map[string]interface{}{
+			"reason": reason,
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+func deliverNotification(n models.Notification) {
+	var err error
+	n.Excerpt = excerpt(n.Excerpt)
+	n.ID, err = models.CreateNotification(n)
+	if err != nil {
+		log.Printf("Failed to store %s notification for user %d: %v", n.Type, n.UserID, err)
+		return
+	}
+	n.CreatedAt = time.Now()
+
+	unread, err := models.CountUnreadNotifications(n.UserID)
+	if err != nil {
+		log.Printf("Failed to count notifications of user %d: %v", n.UserID, err)
+	}
+
+	SendToUser(n.UserID, Message{
+		Type: "notification",
+		Content: map[string]interface{}{
+			"notification": n,
+			"unreadCount":  unread,
+		},
+		Timestamp: n.CreatedAt,
+	})
+}
+
+// NotifyNewComment notifies the followers of post of a new comment. Users
+// mentioned in the comment already heard about it and are left out.
+func NotifyNewComment(post models.Post, comment models.Comment, actorName string, mentioned []models.Mention) {
+	n := models.Notification{
+		ActorID:    comment.UserID,
+		ActorName:  actorName,
+		SourceType: models.TargetComment,
+		SourceID:   comment.ID,
+		PostID:     post.ID,
+		Excerpt:    comment.Content,
+	}
+
+	notifyFollowers(models.FollowPost, post.ID, n, mentioned, func(userID int) string {
+		if userID == post.UserID {
+			return models.NotifyComment
+		}
+		return models.NotifyReply
+	})
+}
+
+// NotifyNewPost notifies the followers of a post's category of the new
+// post, except those mentioned in it.
+func NotifyNewPost(post models.Post, categoryID int, actorName string, mentioned []models.Mention) {
+	n := models.Notification{
+		ActorID:    post.UserID,
+		ActorName:  actorName,
+		SourceType: models.TargetPost,
+		SourceID:   post.ID,
+		PostID:     post.ID,
+		Excerpt:    post.Title,
+	}
+
+	notifyFollowers(models.FollowCategory, categoryID, n, mentioned, func(int) string {
+		return models.NotifyPost
+	})
+}
+
+func notifyFollowers(targetType string, targetID int, n models.Notification, mentioned []models.Mention, kind func(userID int) string) {
+	followers, err := models.GetFollowers(targetType, targetID)
+	if err != nil {
+		log.Printf("Failed to get followers of %s %d: %v", targetType, targetID, err)
+		return
+	}
+
+	skip := make(map[int]bool, len(mentioned))
+	for _, m := range mentioned {
+		skip[m.UserID] = true
+	}
+
+	for _, userID := range followers {
+		if skip[userID] {
+			continue
+		}
+		n.UserID, n.Type = userID, kind(userID)
+		Notify(n)
+	}
+}
@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"RTF/internal/models"
+	"time"
+)
+
+type userPresence struct {
+	// status is the one the user chose; idle is set by the hub when no
+	// activity arrives for a while.
+	status     string
+	idle       bool
+	lastActive time.Time
+}
+
+// visible returns the status other users see, or "" when the user should
+// appear offline.
+func (p *userPresence) visible() string {
+	switch {
+	case p.status == models.StatusInvisible:
+		return ""
+	case p.idle && p.status == models.StatusOnline:
+		return models.StatusAway
+	}
+	return p.status
+}
+
+// hubSnapshot is what other instances need to know about this hub.
+type hubSnapshot struct {
+	users    []int
+	statuses map[int]string
+	rooms    map[string]int
+}
+
+// SetStatus changes the status userID chose, announcing the change.
+func (h *Hub) SetStatus(userID int, status string) {
+	h.do(func() {
+		h.updatePresence(userID, func(p *userPresence) {
+			p.status = status
+			p.idle = false
+			p.lastActive = time.Now()
+		})
+	})
+}
+
+// Touch records activity from userID, bringing them back from idle.
+func (h *Hub) Touch(userID int) {
+	select {
+	case h.activity <- userID:
+	case <-h.stopped:
+	}
+}
+
+// Presence returns the visible status of every user connected to this hub.
+// Invisible users are left out.
+func (h *Hub) Presence() map[int]string {
+	var statuses map[int]string
+	h.do(func() { statuses = h.visibleStatuses() })
+	return statuses
+}
+
+func (h *Hub) snapshot() hubSnapshot {
+	return hubSnapshot{
+		users:    h.onlineUserIDs(),
+		statuses: h.visibleStatuses(),
+		rooms:    h.roomCounts(),
+	}
+}
+
+func (h *Hub) currentSnapshot() hubSnapshot {
+	var snapshot hubSnapshot
+	h.do(func() { snapshot = h.snapshot() })
+	return snapshot
+}
+
+func (h *Hub) publishSnapshot() {
+	if h.onPresence != nil {
+		h.onPresence(h.snapshot())
+	}
+}
+
+func (h *Hub) visibleStatuses() map[int]string {
+	statuses := make(map[int]string, len(h.presence))
+	for userID, p := range h.presence {
+		if status := p.visible(); status != "" {
+			statuses[userID] = status
+		}
+	}
+	return statuses
+}
+
+// updatePresence applies change to a connected user's presence and tells
+// everyone what they can now see of it.
+func (h *Hub) updatePresence(userID int, change func(p *userPresence)) {
+	p := h.presence[userID]
+	if p == nil {
+		return
+	}
+
+	before := p.visible()
+	change(p)
+	if after := p.visible(); after != before {
+		h.announceStatus(userID, before, after, time.Time{})
+		h.publishSnapshot()
+	}
+}
+
+// announceStatus emits the event describing a change of visible status.
+// Becoming invisible looks like going offline, except that user_offline
+// only carries lastSeenAt when lastSeen is set, which remove does for the
+// time it records.
+func (h *Hub) announceStatus(userID int, before, after string, lastSeen time.Time) {
+	now := time.Now()
+
+	switch {
+	case before == after:
+		return
+	case after == "":
+		content := map[string]interface{}{
+			"userId": userID,
+		}
+		if !lastSeen.IsZero() {
+			content["lastSeenAt"] = lastSeen
+		}
+		h.emit(Message{
+			Type:      "user_offline",
+			Content:   content,
+			Timestamp: now,
+		})
+	case before == "":
+		h.emit(Message{
+			Type: "user_online",
+			Content: map[string]interface{}{
+				"userId": userID,
+				"status": after,
+			},
+			Timestamp: now,
+		})
+	default:
+		h.emit(Message{
+			Type: "user_status",
+			Content: map[string]interface{}{
+				"userId": userID,
+				"status": after,
+			},
+			Timestamp: now,
+		})
+	}
+}
+
+// markIdle shows users without recent activity as away.
+func (h *Hub) markIdle(now time.Time) {
+	for userID, p := range h.presence {
+		if !p.idle && now.Sub(p.lastActive) > h.idleTimeout {
+			h.updatePresence(userID, func(p *userPresence) { p.idle = true })
+		}
+	}
+}
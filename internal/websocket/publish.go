@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"RTF/internal/config"
+	"RTF/internal/markup"
+	"RTF/internal/models"
+	"log"
+	"time"
+)
+
+// PostPublished announces a post that just became visible: the clients
+// watching the feed or its category get it as a new_post event, and the
+// users it mentions and the followers of its category are notified. post
+// must be loaded from the database so that it carries its author. Errors
+// are only logged.
+func PostPublished(post models.Post) {
+	authorName := post.User.Nickname
+	mentioned := NotifyMentions(models.Mention{
+		AuthorID:   post.UserID,
+		AuthorName: authorName,
+		SourceType: models.TargetPost,
+		SourceID:   post.ID,
+		PostID:     post.ID,
+	}, markup.Mentions(post.Content), post.Content)
+
+	message := Message{
+		Type: "new_post",
+		Content: map[string]interface{}{
+			"post": post,
+		},
+		Timestamp: time.Now(),
+	}
+	Send(ToRoom(FeedTopic), message)
+
+	category, err := models.GetCategoryByName(post.Category)
+	if err != nil {
+		log.Printf("Failed to load category %q of post %d: %v", post.Category, post.ID, err)
+		return
+	}
+	Send(ToRoom(CategoryTopic(category.ID)), message)
+	NotifyNewPost(post, category.ID, authorName, mentioned)
+}
+
+// publishLoop publishes scheduled posts once they are due.
+func publishLoop() {
+	ticker := time.NewTicker(config.Get().PublishInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			publishDuePosts(time.Now())
+		case <-hub.stopped:
+			return
+		}
+	}
+}
+
+func publishDuePosts(now time.Time) {
+	ids, err := models.GetDuePostIDs(now)
+	if err != nil {
+		log.Printf("Failed to get due scheduled posts: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		// Every instance runs this loop; only the one that flips the post
+		// announces it.
+		published, err := models.PublishPost(id)
+		if err != nil {
+			log.Printf("Failed to publish scheduled post %d: %v", id, err)
+			continue
+		}
+		if !published {
+			continue
+		}
+
+		post, err := models.GetPostByID(id)
+		if err != nil {
+			log.Printf("Failed to load published post %d: %v", id, err)
+			continue
+		}
+		log.Printf("Published scheduled post %d", id)
+		PostPublished(post)
+	}
+}
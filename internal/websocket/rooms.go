@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"RTF/internal/models"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	postTopicPrefix     = "post:"
+	categoryTopicPrefix = "category:"
+
+	// FeedTopic is the room of the clients watching the list of all posts.
+	FeedTopic = "feed"
+)
+
+// PostTopic returns the room of the clients viewing postID.
+func PostTopic(postID int) string {
+	return postTopicPrefix + strconv.Itoa(postID)
+}
+
+// CategoryTopic returns the room of the clients watching the posts of
+// categoryID.
+func CategoryTopic(categoryID int) string {
+	return categoryTopicPrefix + strconv.Itoa(categoryID)
+}
+
+// SendToPost delivers message to the clients viewing postID.
+func SendToPost(postID int, message Message) {
+	Send(ToRoom(PostTopic(postID)), message)
+}
+
+// parseTopicID returns the ID in a topic such as "post:42" that starts with
+// prefix.
+func parseTopicID(topic, prefix string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(topic, prefix))
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid topic %q", topic)
+	}
+	return id, nil
+}
+
+// checkTopic returns an error when topic is not one a client may join.
+func checkTopic(topic string) error {
+	switch {
+	case topic == FeedTopic:
+		return nil
+	case strings.HasPrefix(topic, postTopicPrefix):
+		postID, err := parseTopicID(topic, postTopicPrefix)
+		if err != nil {
+			return err
+		}
+		if _, err := models.GetPostByID(postID); err != nil {
+			return fmt.Errorf("post %d not found", postID)
+		}
+		return nil
+	case strings.HasPrefix(topic, categoryTopicPrefix):
+		categoryID, err := parseTopicID(topic, categoryTopicPrefix)
+		if err != nil {
+			return err
+		}
+		if _, err := models.GetCategoryByID(categoryID); err != nil {
+			return fmt.Errorf("category %d not found", categoryID)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown topic %q", topic)
+}
+
+// handleSubscription processes subscribe and unsubscribe frames of the form
+// {"type": "subscribe", "content": {"topic": "post:42"}}. Besides posts,
+// clients can watch the "feed" of all new posts or those of one
+// "category:<id>".
+func handleSubscription(c *Client, message Message) error {
+	content, ok := message.Content.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid %s content format: expected map[string]interface{}, got %T", message.Type, message.Content)
+	}
+
+	topic, ok := content["topic"].(string)
+	if !ok {
+		return fmt.Errorf("missing topic in %s message", message.Type)
+	}
+
+	if message.Type == "unsubscribe" {
+		c.hub.Leave(c, topic)
+		return nil
+	}
+
+	if err := checkTopic(topic); err != nil {
+		return err
+	}
+
+	c.hub.Join(c, topic)
+	return nil
+}
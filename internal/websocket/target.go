@@ -0,0 +1,45 @@
+package websocket
+
+// Target names the recipients of an event. Exactly one of its fields is
+// meaningful; a zero Target reaches nobody, so forgetting to address an
+// event never leaks it to every client.
+type Target struct {
+	All   bool   `json:"all,omitempty"`
+	Users []int  `json:"users,omitempty"`
+	Room  string `json:"room,omitempty"`
+
+	// client addresses a single connection of this instance, e.g. for
+	// replies to a frame. Such targets are never relayed to the cluster.
+	client *Client
+}
+
+// ToAll addresses every connected client.
+func ToAll() Target {
+	return Target{All: true}
+}
+
+// ToUser addresses every connection of userID.
+func ToUser(userID int) Target {
+	return Target{Users: []int{userID}}
+}
+
+// ToConversation addresses both participants of a private conversation.
+func ToConversation(userID, otherID int) Target {
+	if userID == otherID {
+		return ToUser(userID)
+	}
+	return Target{Users: []int{userID, otherID}}
+}
+
+// ToRoom addresses the clients subscribed to room.
+func ToRoom(room string) Target {
+	return Target{Room: room}
+}
+
+func toClient(c *Client) Target {
+	return Target{client: c}
+}
+
+func (t Target) local() bool {
+	return t.client != nil
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"time"
+)
+
+type typingKey struct {
+	sender   int
+	receiver int
+}
+
+type typingChange struct {
+	typingKey
+	senderName string
+	start      bool
+}
+
+// StartTyping marks sender as typing to receiver. receiver is told once;
+// repeated calls only push back the expiry.
+func (h *Hub) StartTyping(sender, receiver int, senderName string) {
+	h.changeTyping(typingChange{typingKey: typingKey{sender, receiver}, senderName: senderName, start: true})
+}
+
+// StopTyping clears sender's typing state towards receiver, telling the
+// receiver if it was set.
+func (h *Hub) StopTyping(sender, receiver int) {
+	h.changeTyping(typingChange{typingKey: typingKey{sender, receiver}})
+}
+
+func (h *Hub) changeTyping(change typingChange) {
+	select {
+	case h.typingChanges <- change:
+	case <-h.stopped:
+	}
+}
+
+func (h *Hub) applyTyping(change typingChange, now time.Time) {
+	if !change.start {
+		h.stopTyping(change.typingKey)
+		return
+	}
+
+	_, typing := h.typing[change.typingKey]
+	h.typing[change.typingKey] = now.Add(h.typingTimeout)
+	if typing {
+		return
+	}
+
+	h.emitTo(ToUser(change.receiver), Message{
+		Type: "typing_start",
+		Content: map[string]interface{}{
+			"receiverId": change.receiver,
+			"senderName": change.senderName,
+		},
+		Sender:    change.sender,
+		Timestamp: now,
+	})
+}
+
+func (h *Hub) stopTyping(key typingKey) {
+	if _, typing := h.typing[key]; !typing {
+		return
+	}
+	delete(h.typing, key)
+
+	h.emitTo(ToUser(key.receiver), Message{
+		Type: "typing_stop",
+		Content: map[string]interface{}{
+			"receiverId": key.receiver,
+		},
+		Sender:    key.sender,
+		Timestamp: time.Now(),
+	})
+}
+
+// expireTyping stops indicators the client has not refreshed in time, e.g.
+// because the browser tab was closed mid-sentence.
+func (h *Hub) expireTyping(now time.Time) {
+	for key, expires := range h.typing {
+		if now.After(expires) {
+			h.stopTyping(key)
+		}
+	}
+}
+
+// stopTypingFrom clears every indicator of sender.
+func (h *Hub) stopTypingFrom(sender int) {
+	for key := range h.typing {
+		if key.sender == sender {
+			h.stopTyping(key)
+		}
+	}
+}
+
+// rateLimiter is a token bucket allowing rate events per second with bursts
+// of the same size. It is not safe for concurrent use; each client's
+// readPump owns its own.
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+func (l *rateLimiter) allow() bool {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
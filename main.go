@@ -1,69 +1,181 @@
 package main
 
 import (
+	"RTF/internal/config"
 	"RTF/internal/database"
+	"RTF/internal/filter"
 	"RTF/internal/handlers"
+	"RTF/internal/models"
+	"RTF/internal/pubsub"
 	"RTF/internal/websocket"
+	"context"
+	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	config.Set(cfg)
+
 	// Initialize database
-	err := database.Initialize("./forum.db")
+	err = database.Initialize(cfg.DBPath, cfg.SchemaPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	if cfg.Admin != "" {
+		promoted, err := models.PromoteAdmin(cfg.Admin)
+		switch {
+		case err == sql.ErrNoRows:
+			log.Printf("Admin account %q does not exist yet; register it and restart", cfg.Admin)
+		case err != nil:
+			log.Fatalf("Failed to promote admin %q: %v", cfg.Admin, err)
+		case promoted:
+			log.Printf("Promoted %q to admin", cfg.Admin)
+		}
+	}
+
+	if err := models.BackfillContentHTML(); err != nil {
+		log.Fatalf("Failed to render stored content: %v", err)
+	}
+
+	pipeline := filter.FromConfig(cfg)
+	pipeline.OnFiltered = handlers.RecordFiltered
+	filter.Set(pipeline)
+
 	// Initialize WebSocket broadcast system
-	websocket.Initialize()
+	bus, err := pubsub.New(cfg.PubSub)
+	if err != nil {
+		log.Fatalf("Failed to connect to pubsub: %v", err)
+	}
+	if err := websocket.Initialize(bus, cfg.InstanceID); err != nil {
+		log.Fatalf("Failed to initialize WebSocket system: %v", err)
+	}
+
+	router := handlers.NewRouter()
 
 	// Set up static file server
-	fs := http.FileServer(http.Dir("static"))
+	fs := http.FileServer(http.Dir(cfg.StaticDir))
 
 	// Handle static file routes
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+	router.Handle("GET /static/", http.StripPrefix("/static/", fs))
 
 	// Register API routes
-	http.HandleFunc("/api/register", handlers.Register)
-	http.HandleFunc("/api/login", handlers.Login)
-	http.HandleFunc("/api/logout", handlers.Logout)
-	http.HandleFunc("/api/session", handlers.CheckSession)
-	http.HandleFunc("/api/posts", handlers.HandlePosts)
-	http.HandleFunc("/api/posts/", handlers.HandlePostDetail)
-	http.HandleFunc("/api/comments", handlers.HandleComments)
-	http.HandleFunc("/api/users", handlers.GetUsers)
-	http.HandleFunc("/api/users/online", handlers.GetOnlineUsers)
-	http.HandleFunc("/api/users/avatar", handlers.HandleUserAvatar)
-	http.HandleFunc("/api/messages", handlers.GetMessages)
+	router.HandleFunc("POST /api/register", handlers.Register)
+	router.HandleFunc("POST /api/login", handlers.Login)
+	router.HandleFunc("POST /api/logout", handlers.OptionalAuth(handlers.Logout))
+	router.HandleFunc("GET /api/session", handlers.RequireAuth(handlers.CheckSession))
+	router.HandleFunc("GET /api/posts", handlers.RequireAuth(handlers.GetPosts))
+	router.HandleFunc("POST /api/posts", handlers.RequireAuth(handlers.CreatePost))
+	router.HandleFunc("GET /api/scheduled-posts", handlers.RequireAuth(handlers.GetScheduledPosts))
+	router.HandleFunc("PUT /api/scheduled-posts/{id}", handlers.RequireAuth(handlers.UpdateScheduledPost))
+	router.HandleFunc("DELETE /api/scheduled-posts/{id}", handlers.RequireAuth(handlers.CancelScheduledPost))
+	router.HandleFunc("GET /api/posts/{id}", handlers.RequireAuth(handlers.GetPost))
+	router.HandleFunc("DELETE /api/posts/{id}", handlers.RequireAuth(handlers.DeletePost))
+	router.HandleFunc("POST /api/posts/{id}/poll/vote", handlers.RequireAuth(handlers.VotePoll))
+	router.HandleFunc("PUT /api/posts/{id}/follow", handlers.RequireAuth(handlers.FollowPost))
+	router.HandleFunc("DELETE /api/posts/{id}/follow", handlers.RequireAuth(handlers.UnfollowPost))
+	router.HandleFunc("GET /api/comments", handlers.RequireAuth(handlers.GetComments))
+	router.HandleFunc("POST /api/comments", handlers.RequireAuth(handlers.CreateComment))
+	router.HandleFunc("GET /api/users", handlers.RequireAuth(handlers.GetUsers))
+	router.HandleFunc("GET /api/users/online", handlers.RequireAuth(handlers.GetOnlineUsers))
+	router.HandleFunc("GET /api/users/lookup", handlers.RequireAuth(handlers.LookupUsers))
+	router.HandleFunc("POST /api/users/avatar", handlers.RequireAuth(handlers.HandleUserAvatar))
+	router.HandleFunc("GET /api/messages", handlers.RequireAuth(handlers.GetMessages))
+	router.HandleFunc("GET /api/categories", handlers.RequireAuth(handlers.GetCategories))
+	router.HandleFunc("PUT /api/categories/{id}/follow", handlers.RequireAuth(handlers.FollowCategory))
+	router.HandleFunc("DELETE /api/categories/{id}/follow", handlers.RequireAuth(handlers.UnfollowCategory))
+	router.HandleFunc("GET /api/drafts", handlers.RequireAuth(handlers.GetDrafts))
+	router.HandleFunc("GET /api/drafts/{context}", handlers.RequireAuth(handlers.GetDraft))
+	router.HandleFunc("PUT /api/drafts/{context}", handlers.RequireAuth(handlers.SaveDraft))
+	router.HandleFunc("DELETE /api/drafts/{context}", handlers.RequireAuth(handlers.DeleteDraft))
+	router.HandleFunc("GET /api/feed/following", handlers.RequireAuth(handlers.GetFollowingFeed))
+	router.HandleFunc("GET /api/blocks", handlers.RequireAuth(handlers.GetBlocks))
+	router.HandleFunc("PUT /api/blocks/{id}", handlers.RequireAuth(handlers.BlockUser))
+	router.HandleFunc("DELETE /api/blocks/{id}", handlers.RequireAuth(handlers.UnblockUser))
+	router.HandleFunc("POST /api/reports", handlers.RequireAuth(handlers.CreateReport))
+	router.HandleFunc("GET /api/mentions", handlers.RequireAuth(handlers.GetMentions))
+	router.HandleFunc("POST /api/mentions/read", handlers.RequireAuth(handlers.MarkMentionsRead))
+	router.HandleFunc("GET /api/notifications", handlers.RequireAuth(handlers.GetNotifications))
+	router.HandleFunc("POST /api/notifications/read", handlers.RequireAuth(handlers.MarkAllNotificationsRead))
+	router.HandleFunc("POST /api/notifications/{id}/read", handlers.RequireAuth(handlers.MarkNotificationRead))
+
+	// Moderation and administration routes
+	router.HandleFunc("PUT /api/posts/{id}/lock", handlers.RequirePermission(models.PermLockPost, handlers.LockPost))
+	router.HandleFunc("PUT /api/posts/{id}/pin", handlers.RequirePermission(models.PermPinPost, handlers.PinPost))
+	router.HandleFunc("PUT /api/posts/{id}/announcement", handlers.RequirePermission(models.PermAnnounce, handlers.SetAnnouncement))
+	router.HandleFunc("POST /api/users/{id}/mute", handlers.RequirePermission(models.PermMuteUser, handlers.MuteUser))
+	router.HandleFunc("POST /api/users/{id}/ban", handlers.RequirePermission(models.PermBanUser, handlers.BanUser))
+	router.HandleFunc("DELETE /api/users/{id}/ban", handlers.RequirePermission(models.PermBanUser, handlers.UnbanUser))
+	router.HandleFunc("GET /api/moderation/reports", handlers.RequirePermission(models.PermReviewReports, handlers.GetReports))
+	router.HandleFunc("POST /api/moderation/reports/{id}/resolve", handlers.RequirePermission(models.PermReviewReports, handlers.ResolveReport))
+	router.HandleFunc("GET /api/moderation/log", handlers.RequirePermission(models.PermReviewReports, handlers.GetModerationLog))
+	router.HandleFunc("GET /api/moderation/filter-log", handlers.RequirePermission(models.PermReviewReports, handlers.GetFilterLog))
+	router.HandleFunc("POST /api/categories", handlers.RequirePermission(models.PermManageCategories, handlers.CreateCategory))
+	router.HandleFunc("DELETE /api/categories/{id}", handlers.RequirePermission(models.PermManageCategories, handlers.DeleteCategory))
+	router.HandleFunc("PUT /api/admin/users/{id}/role", handlers.RequirePermission(models.PermManageRoles, handlers.UpdateUserRole))
+	router.HandleFunc("DELETE /api/admin/users/{id}", handlers.RequirePermission(models.PermManageUsers, handlers.DeleteUser))
 
 	// WebSocket endpoint
-	http.HandleFunc("/ws", handlers.ServeWs)
+	router.HandleFunc("GET /ws", handlers.RequireAuth(handlers.ServeWs))
 
-	// Serve index.html for all other routes
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" && !isStaticRequest(r.URL.Path) {
-			http.ServeFile(w, r, filepath.Join("static", "index.html"))
+	// Serve index.html for all other routes; unknown API paths get a JSON 404
+	router.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			handlers.NotFound(w, r)
 			return
 		}
-		http.ServeFile(w, r, filepath.Join("static", "index.html"))
+		http.ServeFile(w, r, filepath.Join(cfg.StaticDir, "index.html"))
 	})
 
+	server := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: router,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start server
-	log.Println("Server starting on :http://localhost:8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on %s...", cfg.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("Failed to start server: %v", err)
+	case <-ctx.Done():
 	}
-}
+	stop()
 
-// Helper function to check if a request is for static assets
-func isStaticRequest(path string) bool {
-	staticPaths := []string{"/static/", "/uploads/", "/favicon.ico"}
-	for _, prefix := range staticPaths {
-		if len(path) >= len(prefix) && path[:len(prefix)] == prefix {
-			return true
-		}
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting requests and let in-flight ones finish first, so that
+	// their broadcasts still reach connected clients.
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error draining HTTP connections: %v", err)
+	}
+
+	if err := websocket.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error closing WebSocket connections: %v", err)
 	}
-	return false
+
+	if err := database.Close(); err != nil {
+		log.Printf("Error closing database: %v", err)
+	}
+
+	log.Println("Server stopped")
 }
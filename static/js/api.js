@@ -13,13 +13,20 @@ const api = {
                     return response.text()
                         .then(text => {
                             let errorMessage = `Request failed: ${response.status}`;
+                            let errorCode = null;
                             try {
                                 const errorData = JSON.parse(text);
-                                errorMessage = errorData.error || errorData.message || errorMessage;
+                                if (errorData.error) {
+                                    errorCode = errorData.error.code;
+                                    errorMessage = errorData.error.message || errorMessage;
+                                }
                             } catch (e) {
                                 if (text) errorMessage = text;
                             }
-                            throw new Error(errorMessage);
+                            const error = new Error(errorMessage);
+                            error.code = errorCode;
+                            error.status = response.status;
+                            throw error;
                         });
                 }
                 return response.json();
@@ -57,10 +64,41 @@ const api = {
         });
     },
     
+    put: function(url, data) {
+        return this.fetch(url, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(data)
+        });
+    },
+    
+    delete: function(url) {
+        return this.fetch(url, {
+            method: 'DELETE'
+        });
+    },
+    
     postForm: function(url, formData) {
         return this.fetch(url, {
             method: 'POST',
             body: formData
         });
     }
-};
\ No newline at end of file
+};
+function escapeHtml(text) {
+    return String(text == null ? '' : text)
+        .replace(/&/g, '&amp;')
+        .replace(/</g, '&lt;')
+        .replace(/>/g, '&gt;')
+        .replace(/"/g, '&quot;')
+        .replace(/'/g, '&#39;');
+}
+
+// richContent returns the server-rendered HTML of a post, comment or
+// message, falling back to the escaped source text.
+function richContent(item) {
+    if (item && item.contentHtml) return item.contentHtml;
+    return escapeHtml(item && item.content);
+}
@@ -5,6 +5,7 @@ function checkSession(callback) {
         .then(data => {
             console.log('User session found:', data.user.nickname);
             currentUser = data.user;
+            currentUser.permissions = data.permissions || [];
             if (callback) callback(data.user);
             return data.user;
         })
@@ -17,6 +18,10 @@ function checkSession(callback) {
         });
 }
 
+function hasPermission(permission) {
+    return !!currentUser && (currentUser.permissions || []).includes(permission);
+}
+
 function showLoginForm() {
     console.log('Showing login form');
     
@@ -118,6 +123,7 @@ function handleLogin(e) {
     api.post('/api/login', { login, password })
         .then(data => {
             currentUser = data.user;
+            currentUser.permissions = data.permissions || [];
             showMainContent();
             initWebSocket();
             loadPosts();
@@ -148,6 +154,7 @@ function handleRegister(e) {
     api.post('/api/register', userData)
         .then(data => {
             currentUser = data.user;
+            currentUser.permissions = data.permissions || [];
             showMainContent();
             initWebSocket();
             loadPosts();
@@ -204,10 +211,33 @@ function showMainContent() {
     const userInfo = document.getElementById('user-info');
     if (userInfo) {
         userInfo.innerHTML = `
-            <span>Welcome, ${currentUser.nickname}</span>
+            <span>Welcome, ${escapeHtml(currentUser.nickname)}</span>
+            <select id="presence-select" title="Your status">
+                <option value="online">Online</option>
+                <option value="away">Away</option>
+                <option value="dnd">Do not disturb</option>
+                <option value="invisible">Invisible</option>
+            </select>
         `;
+        
+        const presenceSelect = document.getElementById('presence-select');
+        presenceSelect.value = currentUser.presence || 'online';
+        presenceSelect.addEventListener('change', () => {
+            currentUser.presence = presenceSelect.value;
+            sendFrame({ type: 'set_status', content: { status: presenceSelect.value } });
+        });
     }
 
+    setupMentionAutocomplete(document.getElementById('post-content'));
+    drafts.bind('post', {
+        title: document.getElementById('post-title'),
+        category: document.getElementById('post-category'),
+        content: document.getElementById('post-content')
+    });
+    drafts.load();
+    notificationCenter.init();
+    notificationCenter.load();
+
     const logoutBtn = document.getElementById('logout-btn');
     if (logoutBtn) {
         logoutBtn.addEventListener('click', logout);
@@ -232,4 +262,6 @@ function showMainContent() {
     if (createPostForm) {
         createPostForm.addEventListener('submit', handleCreatePost);
     }
+    
+    loadCategories();
 }
\ No newline at end of file
@@ -1,6 +1,10 @@
 let typingTimeout = null;
 const TYPING_TIMER_LENGTH = 3000;
+// The server drops typing indicators that are not refreshed, so keep
+// re-announcing while the user is still typing.
+const TYPING_REFRESH_INTERVAL = 2500;
 let isTyping = false;
+let lastTypingSent = 0;
 
 function throttle(func, limit) {
     let inThrottle;
@@ -62,7 +66,7 @@ function loadOnlineUsers() {
     api.get('/api/users/online')
         .then(data => {
             if (Date.now() > window.wsState.lastOnlineUsersUpdate) {
-                displayOnlineUsers(data.onlineUsers);
+                displayOnlineUsers(data.onlineUsers, data.statuses || {});
                 window.wsState.lastOnlineUsersUpdate = Date.now();
             }
         })
@@ -73,7 +77,7 @@ function loadOnlineUsers() {
         });
 }
 
-function displayOnlineUsers(onlineUserIds) {
+function displayOnlineUsers(onlineUserIds, statuses = {}) {
     api.get('/api/users')
         .then(data => {
             const onlineUsersContainer = document.getElementById('online-users-list');
@@ -101,10 +105,14 @@ function displayOnlineUsers(onlineUserIds) {
                 if (user.id === currentUser.id) return;
                 
                 const isOnline = onlineUserIds.includes(user.id);
+                const status = statuses[user.id] || 'online';
+                const title = isOnline
+                    ? status
+                    : (user.lastSeenAt ? `Last seen ${new Date(user.lastSeenAt).toLocaleString()}` : 'offline');
                 const userItem = `
-                    <div class="user-item ${isOnline ? 'online' : 'offline'}" data-user-id="${user.id}">
+                    <div class="user-item ${isOnline ? `online status-${status}` : 'offline'}" data-user-id="${user.id}" title="${title}">
                         <span class="user-status"></span>
-                        <span class="user-name">${user.nickname}</span>
+                        <span class="user-name">${escapeHtml(user.nickname)}</span>
                     </div>
                 `;
                 
@@ -120,15 +128,7 @@ function displayOnlineUsers(onlineUserIds) {
             
             document.querySelectorAll('.user-item').forEach(item => {
                 item.addEventListener('click', () => {
-                    const userId = parseInt(item.dataset.userId);
-                    const isOnline = item.classList.contains('online');
-                    
-                    if (!isOnline) {
-                        notifications.warning('Cannot chat with offline users');
-                        return;
-                    }
-                    
-                    openChat(userId);
+                    openChat(parseInt(item.dataset.userId));
                 });
             });
         })
@@ -166,8 +166,8 @@ function displayConversations(conversations, unreadCounts) {
             
             html += `
                 <div class="conversation-item" data-user-id="${otherUserId}">
-                    <div class="conversation-name">${message.senderName}</div>
-                    <div class="conversation-preview">${message.content.substring(0, 30)}${message.content.length > 30 ? '...' : ''}</div>
+                    <div class="conversation-name">${escapeHtml(message.senderName)}</div>
+                    <div class="conversation-preview">${escapeHtml(message.content.substring(0, 30))}${message.content.length > 30 ? '...' : ''}</div>
                     ${unreadCount > 0 ? `<div class="unread-badge">${unreadCount}</div>` : ''}
                 </div>
             `;
@@ -203,10 +203,15 @@ function openChat(userId) {
                     chatContainer.innerHTML = `
                         <div id="chat-header">
                             <button id="back-from-chat-btn">←</button>
-                            <h3>Chat with ${user.nickname}</h3>
+                            <h3>Chat with ${escapeHtml(user.nickname)}</h3>
                             <span class="user-status-indicator ${isOnline ? 'online' : 'offline'}">
                                 ${isOnline ? 'Online' : 'Offline'}
                             </span>
+                            <div class="block-controls">
+                                <button id="mute-user-btn">Mute</button>
+                                <button id="block-user-btn">Block</button>
+                                <button id="report-user-btn">Report</button>
+                            </div>
                         </div>
                         <div class="chat-messages" data-user-id="${userId}">
                             <!-- Messages will be loaded here -->
@@ -220,8 +225,8 @@ function openChat(userId) {
                             </div>
                         </div>
                         <form id="chat-form" data-user-id="${userId}">
-                            <input type="text" id="chat-input" placeholder="${isOnline ? 'Type a message...' : 'User is offline. Messages cannot be sent.'}" ${!isOnline ? 'disabled' : ''} required>
-                            <button type="submit" ${!isOnline ? 'disabled' : ''}>Send</button>
+                            <input type="text" id="chat-input" placeholder="${isOnline ? 'Type a message...' : 'User is offline. They will be notified of your message.'}" required>
+                            <button type="submit">Send</button>
                         </form>
                     `;
                     
@@ -233,23 +238,75 @@ function openChat(userId) {
                     
                     document.getElementById('back-from-chat-btn').addEventListener('click', () => {
                         showSection('posts-container');
+                        loadPosts(postsCategory);
                     });
                     
                     document.getElementById('chat-form').addEventListener('submit', handleSendMessage);
                     
+                    setupBlockControls(userId);
+                    
                     const chatInput = document.getElementById('chat-input');
                     chatInput.addEventListener('input', () => {
                         handleTypingInput(userId);
                     });
+                    setupMentionAutocomplete(chatInput);
+                    drafts.bind(`chat:${userId}`, { content: chatInput });
                     
                     document.getElementById(`typing-indicator-${userId}`).classList.remove('visible');
                 });
         });
 }
 
+// setupBlockControls wires the mute, block and report buttons in the chat
+// header.
+// Blocking hides the user, so it also closes the chat.
+function setupBlockControls(userId) {
+    const muteBtn = document.getElementById('mute-user-btn');
+    const blockBtn = document.getElementById('block-user-btn');
+    let muted = false;
+    
+    api.get('/api/blocks')
+        .then(data => {
+            muted = data.blocks.some(b => b.blockedId === userId && b.kind === 'mute');
+            muteBtn.textContent = muted ? 'Unmute' : 'Mute';
+        })
+        .catch(error => console.error('Error loading blocks:', error));
+    
+    muteBtn.addEventListener('click', () => {
+        const request = muted
+            ? api.delete(`/api/blocks/${userId}`)
+            : api.put(`/api/blocks/${userId}`, { kind: 'mute' });
+        request.then(() => {
+            muted = !muted;
+            muteBtn.textContent = muted ? 'Unmute' : 'Mute';
+            notifications.success(muted ? 'User muted' : 'User unmuted', 2000);
+        }).catch(() => {});
+    });
+    
+    document.getElementById('report-user-btn').addEventListener('click', () => {
+        reportContent('user', userId);
+    });
+    
+    blockBtn.addEventListener('click', () => {
+        if (!confirm('Block this user? They will not be able to message you.')) {
+            return;
+        }
+        api.put(`/api/blocks/${userId}`, { kind: 'block' })
+            .then(() => {
+                notifications.success('User blocked', 2000);
+                loadOnlineUsers();
+                loadConversations();
+                showSection('posts-container');
+                loadPosts(postsCategory);
+            })
+            .catch(() => {});
+    });
+}
+
 function handleTypingInput(receiverId) {
-    if (!isTyping) {
+    if (!isTyping || Date.now() - lastTypingSent > TYPING_REFRESH_INTERVAL) {
         isTyping = true;
+        lastTypingSent = Date.now();
         const message = {
             type: 'typing_start',
             content: {
@@ -314,7 +371,7 @@ function displayMessages(messages, userId) {
             
             html += `
                 <div class="message ${isFromMe ? 'sent' : 'received'}">
-                    <div class="message-content">${message.content}</div>
+                    <div class="message-content">${richContent(message)}</div>
                     <div class="message-time">${time}</div>
                 </div>
             `;
@@ -405,7 +462,7 @@ function setupScrollListener(userId) {
             
             html += `
                 <div class="message ${isFromMe ? 'sent' : 'received'}">
-                    <div class="message-content">${message.content}</div>
+                    <div class="message-content">${richContent(message)}</div>
                     <div class="message-time">${time}</div>
                 </div>
             `;
@@ -425,84 +482,70 @@ function handleSendMessage(e) {
     
     if (!content.trim()) return;
     
-    api.get(`/api/users/online`)
-        .then(data => {
-            const isOnline = data.onlineUsers.includes(userId);
-            
-            if (!isOnline) {
-                notifications.error("Cannot send message. User is offline.");
-                updateChatUIForStatusChange(userId, false);
-                return;
-            }
-            
-            if (typingTimeout) {
-                clearTimeout(typingTimeout);
-            }
-            
-            isTyping = false;
-            
-            const stopTypingMessage = {
-                type: 'typing_stop',
-                content: {
-                    receiverId: userId
-                }
-            };
-            
-            if (socket && socket.readyState === WebSocket.OPEN) {
-                socket.send(JSON.stringify(stopTypingMessage));
-            }
-            
-            const message = {
-                type: 'chat_message',
-                content: {
-                    receiverId: userId,
-                    content: content
-                }
-            };
-            
-            if (socket && socket.readyState === WebSocket.OPEN) {
-                socket.send(JSON.stringify(message));
-                form.querySelector('#chat-input').value = '';
-                
-                const messagesContainer = document.querySelector(`.chat-messages[data-user-id="${userId}"]`);
-                if (messagesContainer) {
-                    const time = new Date().toLocaleTimeString();
-                    const messageDiv = document.createElement('div');
-                    messageDiv.className = 'message sent';
-                    messageDiv.innerHTML = `
-                        <div class="message-content">${content}</div>
-                        <div class="message-time">${time}</div>
-                    `;
-                    messagesContainer.appendChild(messageDiv);
-                    messagesContainer.scrollTop = messagesContainer.scrollHeight;
-                }
-            } else {
-                window.messageQueue = window.messageQueue || [];
-                window.messageQueue.push(message);
-                
-                const messagesContainer = document.querySelector(`.chat-messages[data-user-id="${userId}"]`);
-                if (messagesContainer) {
-                    const time = new Date().toLocaleTimeString();
-                    const messageDiv = document.createElement('div');
-                    messageDiv.className = 'message sent pending';
-                    messageDiv.innerHTML = `
-                        <div class="message-content">${content}</div>
-                        <div class="message-time">${time} (Pending)</div>
-                    `;
-                    messagesContainer.appendChild(messageDiv);
-                    messagesContainer.scrollTop = messagesContainer.scrollHeight;
-                }
-                
-                notifications.warning('Currently offline. Message will be sent when connection is restored.');
-                
-                form.querySelector('#chat-input').value = '';
-                
-                if (window.wsState.connectionStatus === 'disconnected' && !window.wsState.reconnectTimer) {
-                    initWebSocket();
-                }
-            }
-        })
-        .catch(error => {
-            notifications.error("Error checking user status");
-        });
+    if (typingTimeout) {
+        clearTimeout(typingTimeout);
+    }
+    
+    isTyping = false;
+    
+    const stopTypingMessage = {
+        type: 'typing_stop',
+        content: {
+            receiverId: userId
+        }
+    };
+    
+    if (socket && socket.readyState === WebSocket.OPEN) {
+        socket.send(JSON.stringify(stopTypingMessage));
+    }
+    
+    const message = {
+        type: 'chat_message',
+        content: {
+            receiverId: userId,
+            content: content
+        }
+    };
+    
+    if (socket && socket.readyState === WebSocket.OPEN) {
+        socket.send(JSON.stringify(message));
+        form.querySelector('#chat-input').value = '';
+        
+        const messagesContainer = document.querySelector(`.chat-messages[data-user-id="${userId}"]`);
+        if (messagesContainer) {
+            const time = new Date().toLocaleTimeString();
+            const messageDiv = document.createElement('div');
+            messageDiv.className = 'message sent';
+            messageDiv.innerHTML = `
+                <div class="message-content">${escapeHtml(content)}</div>
+                <div class="message-time">${time}</div>
+            `;
+            messagesContainer.appendChild(messageDiv);
+            messagesContainer.scrollTop = messagesContainer.scrollHeight;
+        }
+    } else {
+        window.messageQueue = window.messageQueue || [];
+        window.messageQueue.push(message);
+        
+        const messagesContainer = document.querySelector(`.chat-messages[data-user-id="${userId}"]`);
+        if (messagesContainer) {
+            const time = new Date().toLocaleTimeString();
+            const messageDiv = document.createElement('div');
+            messageDiv.className = 'message sent pending';
+            messageDiv.innerHTML = `
+                <div class="message-content">${escapeHtml(content)}</div>
+                <div class="message-time">${time} (Pending)</div>
+            `;
+            messagesContainer.appendChild(messageDiv);
+            messagesContainer.scrollTop = messagesContainer.scrollHeight;
+        }
+        
+        notifications.warning('Currently offline. Message will be sent when connection is restored.');
+        
+        form.querySelector('#chat-input').value = '';
+        
+        if (window.wsState.connectionStatus === 'disconnected' && !window.wsState.reconnectTimer) {
+            initWebSocket();
+        }
+    }
 }
\ No newline at end of file
@@ -0,0 +1,87 @@
+// Drafts are autosaved per context ("post", "comment:<postId>" or
+// "chat:<userId>") and kept in sync across the user's devices.
+const drafts = {
+    saved: {},
+    // bindings holds the form fields of each context shown on this page.
+    bindings: {},
+    timers: {},
+
+    load: function() {
+        return api.get('/api/drafts')
+            .then(data => {
+                this.saved = {};
+                (data.drafts || []).forEach(draft => this.saved[draft.context] = draft);
+                Object.keys(this.bindings).forEach(context => this.fill(context));
+            })
+            .catch(error => console.error('Error loading drafts:', error));
+    },
+
+    // bind restores the draft of context into fields ({content, title,
+    // category}, only content is required) and autosaves them as they
+    // change.
+    bind: function(context, fields) {
+        this.bindings[context] = fields;
+        this.fill(context);
+
+        Object.values(fields).forEach(field => {
+            if (!field || field.dataset.draft) return;
+            field.dataset.draft = context;
+            const save = () => this.schedule(context);
+            field.addEventListener('input', save);
+            field.addEventListener('change', save);
+        });
+    },
+
+    fill: function(context) {
+        const fields = this.bindings[context];
+        const draft = this.saved[context];
+        if (!fields || !draft || this.editing(fields)) return;
+        Object.entries(fields).forEach(([name, field]) => {
+            if (field && draft[name] !== undefined) field.value = draft[name];
+        });
+    },
+
+    // editing reports whether the user is typing in one of fields, whose
+    // value must then not be replaced by a synced one.
+    editing: function(fields) {
+        return Object.values(fields).some(field => field && field === document.activeElement && field.value);
+    },
+
+    schedule: function(context) {
+        clearTimeout(this.timers[context]);
+        this.timers[context] = setTimeout(() => this.save(context), 1000);
+    },
+
+    save: function(context) {
+        const fields = this.bindings[context];
+        if (!fields) return;
+
+        const draft = {};
+        Object.entries(fields).forEach(([name, field]) => {
+            if (field) draft[name] = field.value;
+        });
+        api.put(`/api/drafts/${encodeURIComponent(context)}`, draft)
+            .catch(error => console.error('Error saving draft:', error));
+    },
+
+    handleUpdated: function(message) {
+        const draft = message.content?.draft;
+        if (!draft) return;
+        this.saved[draft.context] = draft;
+        this.fill(draft.context);
+    },
+
+    handleDeleted: function(message) {
+        const context = message.content?.context;
+        if (!context) return;
+        delete this.saved[context];
+
+        const fields = this.bindings[context];
+        if (fields && !this.editing(fields)) {
+            clearTimeout(this.timers[context]);
+            Object.values(fields).forEach(field => {
+                if (field && field.tagName !== 'SELECT') field.value = '';
+            });
+        }
+    }
+};
@@ -0,0 +1,83 @@
+document.addEventListener('DOMContentLoaded', function() {
+    const followingBtn = document.getElementById('following-btn');
+    if (followingBtn) {
+        followingBtn.addEventListener('click', () => {
+            showSection('following-container');
+            loadFollowing();
+        });
+    }
+});
+
+// loadFollowing shows the followed threads and every category with a
+// follow toggle, each marked with what is new since the last visit.
+function loadFollowing() {
+    Promise.all([api.get('/api/feed/following'), api.get('/api/categories')])
+        .then(([feed, categoryData]) => {
+            const followed = {};
+            (feed.categories || []).forEach(category => followed[category.id] = category);
+            displayFollowedCategories(categoryData.categories || [], followed);
+            displayFollowedPosts(feed.posts || []);
+        })
+        .catch(error => {
+            if (error.message !== 'Session expired') {
+                console.error('Error loading followed content:', error);
+            }
+        });
+}
+
+function displayFollowedCategories(categories, followed) {
+    const container = document.getElementById('following-categories');
+    
+    container.innerHTML = categories.map(category => {
+        const entry = followed[category.id];
+        return `
+            <div class="following-item" data-id="${category.id}" data-name="${escapeHtml(category.name)}">
+                <a href="#" class="following-category">${escapeHtml(category.name)}</a>
+                ${entry && entry.newPosts > 0 ? `<span class="new-badge">${entry.newPosts} new</span>` : ''}
+                <button class="follow-btn">${entry ? 'Unfollow' : 'Follow'}</button>
+            </div>
+        `;
+    }).join('') || '<p>No categories.</p>';
+    
+    container.querySelectorAll('.following-item').forEach(item => {
+        item.querySelector('.following-category').addEventListener('click', e => {
+            e.preventDefault();
+            showSection('posts-container');
+            loadPosts(item.dataset.name);
+        });
+        
+        item.querySelector('.follow-btn').addEventListener('click', () => {
+            const id = item.dataset.id;
+            const request = followed[id]
+                ? api.delete(`/api/categories/${id}/follow`)
+                : api.put(`/api/categories/${id}/follow`, {});
+            request
+                .then(() => loadFollowing())
+                .catch(error => console.error('Error updating follow:', error));
+        });
+    });
+}
+
+function displayFollowedPosts(posts) {
+    const container = document.getElementById('following-posts');
+    
+    if (posts.length === 0) {
+        container.innerHTML = '<p>You are not following any threads yet. Threads you start or comment on are followed automatically.</p>';
+        return;
+    }
+    
+    container.innerHTML = posts.map(post => `
+        <div class="following-item ${post.unreadComments > 0 ? 'unread' : ''}" data-id="${post.id}">
+            <a href="#" class="following-post">${escapeHtml(post.title)}</a>
+            ${post.unreadComments > 0 ? `<span class="new-badge">${post.unreadComments} new</span>` : ''}
+            <span class="post-meta">in ${escapeHtml(post.category)} · last activity ${new Date(post.lastActivityAt).toLocaleString()}</span>
+        </div>
+    `).join('');
+    
+    container.querySelectorAll('.following-post').forEach(link => {
+        link.addEventListener('click', e => {
+            e.preventDefault();
+            viewPost(parseInt(link.closest('.following-item').dataset.id));
+        });
+    });
+}
@@ -5,6 +5,14 @@ window.wsState = {
   reconnectAttempts: 0,
   lastOnlineUsersUpdate: 0,
   lastConversationsUpdate: 0,
+  reconnectHint: null,
+  postTopic: null,
+  postViewers: 0,
+  // feedTopic is the topic of the post list being shown and lastPostAt
+  // the creation time of its newest post, from which to catch up after a
+  // reconnect.
+  feedTopic: null,
+  lastPostAt: null,
   maxReconnectDelay: 30000 
 };
 
@@ -18,6 +26,7 @@ document.addEventListener('DOMContentLoaded', function() {
             initWebSocket();
             loadPosts();
             loadOnlineUsers();
+            setupActivityTracking();
             
             setInterval(loadOnlineUsers, 30000);
         }
@@ -52,6 +61,13 @@ document.addEventListener('DOMContentLoaded', function() {
 function showSection(sectionId) {
     console.log('Showing section:', sectionId);
     
+    if (sectionId !== 'post-detail-container') {
+        unsubscribeFromPost();
+    }
+    if (sectionId !== 'posts-container') {
+        unsubscribeFromFeed();
+    }
+    
     document.querySelectorAll('.content-section').forEach(section => {
         section.classList.add('hidden');
     });
@@ -69,7 +85,9 @@ function showSection(sectionId) {
     
     const navMap = {
         'posts-container': 'home-btn',
-        'create-post-container': 'create-post-btn'
+        'create-post-container': 'create-post-btn',
+        'following-container': 'following-btn',
+        'scheduled-container': 'scheduled-btn'
     };
     
     if (navMap[sectionId]) {
@@ -107,6 +125,14 @@ function initWebSocket() {
         updateConnectionStatus('connected');
         notifications.success('Connected to chat server');
         initChat();
+        
+        if (wsState.postTopic) {
+            sendFrame({ type: 'subscribe', content: { topic: wsState.postTopic } });
+        }
+        if (wsState.feedTopic) {
+            sendFrame({ type: 'subscribe', content: { topic: wsState.feedTopic } });
+            backfillPosts();
+        }
     };
     
     socket.onmessage = function(event) {
@@ -129,12 +155,35 @@ function initWebSocket() {
                 updateChatUIForStatusChange(message.content, false);
                 break;
                 
+            case 'user_status':
+                loadOnlineUsers();
+                break;
+                
             case 'new_post':
+                addNewPost(message.content?.post);
+                break;
+                
+            case 'post_locked':
+            case 'post_pinned':
                 if (!document.getElementById('posts-container').classList.contains('hidden')) {
-                    loadPosts();
+                    loadPosts(postsCategory);
+                } else if (wsState.postTopic === `post:${message.content?.postId}`) {
+                    viewPost(message.content.postId);
                 }
                 break;
                 
+            case 'draft_updated':
+                drafts.handleUpdated(message);
+                break;
+                
+            case 'draft_deleted':
+                drafts.handleDeleted(message);
+                break;
+                
+            case 'poll_results':
+                handlePollResults(message);
+                break;
+                
             case 'new_comment':
                 const openPostId = document.querySelector('#comment-form')?.dataset.postId;
                 if (openPostId && parseInt(openPostId) === message.content.postId) {
@@ -142,6 +191,48 @@ function initWebSocket() {
                 }
                 break;
                 
+            case 'viewers':
+                if (message.content?.topic === wsState.postTopic) {
+                    wsState.postViewers = message.content.count;
+                    renderPostViewers();
+                }
+                break;
+                
+            case 'post_deleted':
+                if (wsState.postTopic === `post:${message.content?.postId}`) {
+                    notifications.warning('This post has been deleted');
+                    showSection('posts-container');
+                    loadPosts();
+                }
+                break;
+                
+            case 'comment_deleted':
+                if (wsState.postTopic === `post:${message.content?.postId}`) {
+                    viewPost(message.content.postId);
+                }
+                break;
+                
+            case 'message_deleted': {
+                const openChatId = document.querySelector('.chat-messages')?.dataset.userId;
+                if (openChatId) {
+                    loadMessages(parseInt(openChatId));
+                }
+                loadConversations();
+                break;
+            }
+                
+            case 'mention':
+                handleMention(message);
+                break;
+                
+            case 'notification':
+                notificationCenter.handlePush(message);
+                break;
+                
+            case 'warning':
+                notifications.warning(`Warning from the moderators: ${message.content?.reason || 'please follow the forum rules'}`, 10000);
+                break;
+                
             case 'typing_start':
                 handleTypingStart(message);
                 break;
@@ -154,6 +245,11 @@ function initWebSocket() {
                 handleServerError(message);
                 break;
                 
+            case 'server_shutdown':
+                wsState.reconnectHint = message.content?.reconnectAfterMs ?? null;
+                notifications.warning('Server is restarting. Reconnecting shortly...');
+                break;
+                
             case 'pong':
                 lastPongReceived = Date.now();
                 break;
@@ -164,6 +260,15 @@ function initWebSocket() {
         console.log(`WebSocket connection closed: ${event.code} - ${event.reason}`);
         updateConnectionStatus('disconnected');
         
+        // The server closes a banned user's socket with 1008 and a reason
+        // starting with "banned"; reconnecting would only be refused.
+        if (event.code === 1008 && event.reason.startsWith('banned')) {
+            wsState.intentionalDisconnect = true;
+            notifications.error(`Your account has been ${event.reason}`, 10000);
+            handleSessionExpired();
+            return;
+        }
+        
         if (!wsState.intentionalDisconnect) {
             api.get('/api/session')
                 .then(() => {
@@ -189,6 +294,75 @@ function initWebSocket() {
     setupHeartbeat();
 }
 
+// The server marks users as away when it hears nothing from them, so report
+// user input at most once per ACTIVITY_INTERVAL.
+const ACTIVITY_INTERVAL = 30000;
+let lastActivitySent = 0;
+
+function setupActivityTracking() {
+    const reportActivity = () => {
+        if (Date.now() - lastActivitySent < ACTIVITY_INTERVAL) return;
+        lastActivitySent = Date.now();
+        sendFrame({ type: 'activity' });
+    };
+    
+    ['mousemove', 'keydown', 'click', 'scroll', 'touchstart'].forEach(eventName => {
+        document.addEventListener(eventName, reportActivity, { passive: true });
+    });
+    document.addEventListener('visibilitychange', () => {
+        if (!document.hidden) reportActivity();
+    });
+}
+
+function sendFrame(frame) {
+    if (socket && socket.readyState === WebSocket.OPEN) {
+        socket.send(JSON.stringify(frame));
+    }
+}
+
+function subscribeToPost(postId) {
+    const topic = `post:${postId}`;
+    if (wsState.postTopic === topic) return;
+    
+    unsubscribeFromPost();
+    wsState.postTopic = topic;
+    wsState.postViewers = 0;
+    sendFrame({ type: 'subscribe', content: { topic } });
+}
+
+function unsubscribeFromPost() {
+    if (!wsState.postTopic) return;
+    
+    sendFrame({ type: 'unsubscribe', content: { topic: wsState.postTopic } });
+    wsState.postTopic = null;
+    wsState.postViewers = 0;
+}
+
+function subscribeToFeed(topic) {
+    if (!topic || wsState.feedTopic === topic) return;
+    
+    unsubscribeFromFeed();
+    wsState.feedTopic = topic;
+    sendFrame({ type: 'subscribe', content: { topic } });
+}
+
+function unsubscribeFromFeed() {
+    if (!wsState.feedTopic) return;
+    
+    sendFrame({ type: 'unsubscribe', content: { topic: wsState.feedTopic } });
+    wsState.feedTopic = null;
+}
+
+function renderPostViewers() {
+    const element = document.getElementById('post-viewers');
+    if (!element) return;
+    
+    const others = wsState.postViewers - 1;
+    element.textContent = others > 0
+        ? `${others} other ${others === 1 ? 'person' : 'people'} reading`
+        : '';
+}
+
 let lastPongReceived = Date.now();
 let heartbeatInterval = null;
 
@@ -212,7 +386,12 @@ function setupHeartbeat() {
 }
 
 function handleReconnect() {
-    const delay = Math.min(1000 * Math.pow(2, wsState.reconnectAttempts), wsState.maxReconnectDelay);
+    let delay = Math.min(1000 * Math.pow(2, wsState.reconnectAttempts), wsState.maxReconnectDelay);
+    if (wsState.reconnectHint !== null) {
+        // The server announced a restart; add jitter so clients don't reconnect all at once
+        delay = wsState.reconnectHint + Math.floor(Math.random() * 1000);
+        wsState.reconnectHint = null;
+    }
     wsState.reconnectAttempts++;
     
     notifications.warning(`Connection lost. Reconnecting in ${Math.round(delay/1000)} seconds...`);
@@ -247,8 +426,21 @@ function updateConnectionStatus(status) {
 
 function handleServerError(message) {
     const errorMessage = message.content?.message || 'Unknown server error';
-    notifications.error(`Server error: ${errorMessage}`);
     console.error('Server reported an error:', message);
+    
+    // Sent messages are shown before the server accepts them; reload the
+    // conversation so that a refused one disappears.
+    const code = message.content?.code;
+    if (code === 'content_rejected' || code === 'blocked' || code === 'locked') {
+        notifications.error(`Not sent: ${errorMessage}`);
+        const openChatId = document.querySelector('.chat-messages')?.dataset.userId;
+        if (openChatId) {
+            loadMessages(parseInt(openChatId));
+        }
+        return;
+    }
+    
+    notifications.error(`Server error: ${errorMessage}`);
 }
 
 function handleSessionExpired() {
@@ -308,7 +500,7 @@ function handleIncomingMessage(message) {
             const messageDiv = document.createElement('div');
             messageDiv.className = 'message received';
             messageDiv.innerHTML = `
-                <div class="message-content">${content}</div>
+                <div class="message-content">${richContent(message.content)}</div>
                 <div class="message-time">${time}</div>
             `;
             
@@ -316,7 +508,7 @@ function handleIncomingMessage(message) {
             
             messagesContainer.scrollTop = messagesContainer.scrollHeight;
         }
-    } else if (senderId !== currentUser.id) {
+    } else if (senderId !== currentUser.id && !message.content.muted) {
         api.get(`/api/users?id=${senderId}`)
             .then(data => {
                 const user = data.users.find(u => u.id === senderId);
@@ -407,7 +599,7 @@ function updateChatUIForStatusChange(content, isOnline) {
     const chatHeader = document.getElementById('chat-header');
     
     if (isOnline) {
-        if (chatInput) chatInput.disabled = false;
+        if (chatInput) chatInput.placeholder = 'Type a message...';
         if (chatHeader) {
             const statusElement = chatHeader.querySelector('.user-status-indicator') || document.createElement('span');
             statusElement.className = 'user-status-indicator online';
@@ -416,12 +608,9 @@ function updateChatUIForStatusChange(content, isOnline) {
                 chatHeader.appendChild(statusElement);
             }
         }
-        notifications.info(`User is now online and can receive messages.`);
+        notifications.info(`User is now online.`);
     } else {
-        if (chatInput) {
-            chatInput.disabled = true;
-            chatInput.placeholder = "User is offline. Messages cannot be sent.";
-        }
+        if (chatInput) chatInput.placeholder = 'User is offline. They will be notified of your message.';
         if (chatHeader) {
             const statusElement = chatHeader.querySelector('.user-status-indicator') || document.createElement('span');
             statusElement.className = 'user-status-indicator offline';
@@ -430,6 +619,6 @@ function updateChatUIForStatusChange(content, isOnline) {
                 chatHeader.appendChild(statusElement);
             }
         }
-        notifications.warning(`User has gone offline. Messages cannot be sent until they return.`);
+        notifications.info(`User has gone offline. They will be notified of new messages.`);
     }
 }
@@ -0,0 +1,88 @@
+// openMention shows the post or conversation a mention came from and marks
+// it as read.
+function openMention(mention) {
+    api.post('/api/mentions/read', { ids: [mention.id] }).catch(() => {});
+
+    if (mention.postId) {
+        viewPost(mention.postId);
+    } else if (mention.sourceType === 'message') {
+        openChat(mention.authorId);
+    }
+}
+
+function handleMention(message) {
+    const mention = message.content?.mention;
+    if (!mention) return;
+
+    const where = mention.sourceType === 'message' ? 'a message' : `a ${mention.sourceType}`;
+    const toast = notifications.info(`${mention.authorName || 'Someone'} mentioned you in ${where}: ${message.content.excerpt || ''}`, 8000);
+    toast.addEventListener('click', () => openMention(mention));
+}
+
+// setupMentionAutocomplete suggests nicknames while an @mention is typed
+// into input.
+function setupMentionAutocomplete(input) {
+    if (!input || input.dataset.mentions) return;
+    input.dataset.mentions = 'on';
+
+    const list = document.createElement('ul');
+    list.className = 'mention-suggestions hidden';
+    input.insertAdjacentElement('afterend', list);
+
+    let lookup = null;
+
+    const close = () => list.classList.add('hidden');
+
+    const currentMention = () => {
+        const before = input.value.slice(0, input.selectionStart);
+        const match = before.match(/(^|[^\w@])@([\p{L}\p{N}_.\-]*)$/u);
+        return match ? match[2] : null;
+    };
+
+    const insert = nickname => {
+        const caret = input.selectionStart;
+        const before = input.value.slice(0, caret).replace(/@[\p{L}\p{N}_.\-]*$/u, `@${nickname} `);
+        input.value = before + input.value.slice(caret);
+        input.selectionStart = input.selectionEnd = before.length;
+        input.focus();
+        close();
+    };
+
+    input.addEventListener('input', () => {
+        const prefix = currentMention();
+        clearTimeout(lookup);
+        if (!prefix) {
+            close();
+            return;
+        }
+
+        lookup = setTimeout(() => {
+            api.get(`/api/users/lookup?prefix=${encodeURIComponent(prefix)}`)
+                .then(data => {
+                    const users = data.users || [];
+                    if (users.length === 0 || currentMention() !== prefix) {
+                        close();
+                        return;
+                    }
+                    list.innerHTML = users
+                        .map(user => `<li data-nickname="${escapeHtml(user.nickname)}">@${escapeHtml(user.nickname)}</li>`)
+                        .join('');
+                    list.classList.remove('hidden');
+                })
+                .catch(close);
+        }, 150);
+    });
+
+    list.addEventListener('mousedown', e => {
+        const item = e.target.closest('li');
+        if (item) {
+            e.preventDefault();
+            insert(item.dataset.nickname);
+        }
+    });
+
+    input.addEventListener('blur', close);
+    input.addEventListener('keydown', e => {
+        if (e.key === 'Escape') close();
+    });
+}
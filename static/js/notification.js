@@ -95,4 +95,126 @@ style.textContent = `
     to { transform: translateX(100%); opacity: 0; }
 }
 `;
-document.head.appendChild(style);
\ No newline at end of file
+document.head.appendChild(style);
+// notificationCenter keeps the header badge and the list of persistent
+// notifications stored by the server.
+const notificationCenter = {
+    items: [],
+    unreadCount: 0,
+    bound: false,
+    
+    init() {
+        if (this.bound) return;
+        this.bound = true;
+        
+        document.getElementById('notification-btn').addEventListener('click', () => {
+            const panel = document.getElementById('notification-panel');
+            panel.classList.toggle('hidden');
+            if (!panel.classList.contains('hidden')) {
+                this.load();
+            }
+        });
+        document.getElementById('notification-read-all').addEventListener('click', () => {
+            api.post('/api/notifications/read', {})
+                .then(data => {
+                    this.items.forEach(item => item.read = true);
+                    this.setUnread(data.unreadCount);
+                    this.render();
+                })
+                .catch(error => console.error('Error marking notifications read:', error));
+        });
+    },
+    
+    load() {
+        api.get('/api/notifications')
+            .then(data => {
+                this.items = data.notifications || [];
+                this.setUnread(data.unreadCount);
+                this.render();
+            })
+            .catch(error => console.error('Error loading notifications:', error));
+    },
+    
+    describe(item) {
+        const actor = item.actorName || 'Someone';
+        switch (item.type) {
+            case 'comment': return `${actor} commented on your post`;
+            case 'reply': return `${actor} replied in a thread you follow`;
+            case 'post': return `${actor} posted in a category you follow`;
+            case 'mention': return `${actor} mentioned you`;
+            case 'message': return `${actor} sent you a message`;
+            case 'warning': return 'The moderators warned you';
+            default: return `${actor} did something`;
+        }
+    },
+    
+    render() {
+        const list = document.getElementById('notification-list');
+        if (!list) return;
+        
+        if (this.items.length === 0) {
+            list.innerHTML = '<p class="notification-empty">No notifications yet.</p>';
+            return;
+        }
+        
+        list.innerHTML = this.items.map(item => `
+            <div class="notification-item ${item.read ? '' : 'unread'}" data-id="${item.id}">
+                <div class="notification-text">${escapeHtml(this.describe(item))}</div>
+                ${item.excerpt ? `<div class="notification-excerpt">${escapeHtml(item.excerpt)}</div>` : ''}
+                <div class="notification-time">${new Date(item.createdAt).toLocaleString()}</div>
+            </div>
+        `).join('');
+        
+        list.querySelectorAll('.notification-item').forEach(el => {
+            el.addEventListener('click', () => {
+                const item = this.items.find(i => i.id === parseInt(el.dataset.id));
+                if (item) this.open(item);
+            });
+        });
+    },
+    
+    // open shows what the notification is about and marks it read.
+    open(item) {
+        document.getElementById('notification-panel').classList.add('hidden');
+        
+        if (!item.read) {
+            api.post(`/api/notifications/${item.id}/read`, {})
+                .then(data => {
+                    item.read = true;
+                    this.setUnread(data.unreadCount);
+                    this.render();
+                })
+                .catch(error => console.error('Error marking notification read:', error));
+        }
+        
+        if (item.postId) {
+            viewPost(item.postId);
+        } else if (item.sourceType === 'message') {
+            openChat(item.actorId);
+        }
+    },
+    
+    setUnread(count) {
+        this.unreadCount = count || 0;
+        const badge = document.getElementById('notification-badge');
+        if (!badge) return;
+        badge.textContent = this.unreadCount;
+        badge.classList.toggle('hidden', this.unreadCount === 0);
+    },
+    
+    // handlePush takes a notification event from the WebSocket.
+    handlePush(message) {
+        const item = message.content?.notification;
+        if (!item) return;
+        
+        this.items.unshift(item);
+        this.setUnread(message.content.unreadCount);
+        this.render();
+        
+        // Mentions announce themselves with their own event.
+        if (item.type !== 'mention') {
+            const toast = notifications.info(this.describe(item));
+            toast.addEventListener('click', () => this.open(item));
+        }
+    }
+};
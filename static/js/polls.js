@@ -0,0 +1,128 @@
+document.addEventListener('DOMContentLoaded', function() {
+    const toggle = document.getElementById('poll-enabled');
+    const multiple = document.getElementById('poll-multiple');
+    if (toggle) {
+        toggle.addEventListener('change', () => {
+            document.getElementById('poll-fields').classList.toggle('hidden', !toggle.checked);
+        });
+    }
+    if (multiple) {
+        multiple.addEventListener('change', () => {
+            document.getElementById('poll-max-choices').disabled = !multiple.checked;
+        });
+    }
+});
+
+// readPollForm returns the poll to send with a new post, null when no poll
+// was asked for, or throws when the form is incomplete.
+function readPollForm(form) {
+    if (!form.querySelector('#poll-enabled')?.checked) return null;
+
+    const options = form.querySelector('#poll-options').value
+        .split('\n')
+        .map(option => option.trim())
+        .filter(option => option)
+        .map(text => ({ text }));
+    if (options.length < 2) {
+        throw new Error('A poll needs at least two options, one per line');
+    }
+
+    const poll = {
+        options,
+        multiple: form.querySelector('#poll-multiple').checked,
+        anonymous: form.querySelector('#poll-anonymous').checked
+    };
+    if (poll.multiple) {
+        poll.maxChoices = parseInt(form.querySelector('#poll-max-choices').value) || 0;
+    }
+    const closesAt = form.querySelector('#poll-closes-at').value;
+    if (closesAt) {
+        poll.closesAt = new Date(closesAt).toISOString();
+    }
+    return poll;
+}
+
+// currentPoll is the poll of the open post, kept so that live results can
+// be shown with the viewer's own choices.
+let currentPoll = null;
+
+function renderPoll(postId, poll) {
+    const container = document.getElementById('post-poll');
+    if (!container) return;
+    if (!poll) {
+        currentPoll = null;
+        container.innerHTML = '';
+        return;
+    }
+    currentPoll = { postId, ...poll };
+
+    const myVotes = poll.myVotes || [];
+    const canVote = !poll.closed;
+    const inputType = poll.maxChoices > 1 ? 'checkbox' : 'radio';
+    const total = poll.totalVoters || 0;
+
+    const options = (poll.options || []).map(option => {
+        const share = total > 0 ? Math.round(option.votes * 100 / total) : 0;
+        const voters = option.voters?.length ? `<span class="poll-voters">${option.voters.map(escapeHtml).join(', ')}</span>` : '';
+        return `
+            <label class="poll-option${myVotes.includes(option.id) ? ' chosen' : ''}">
+                ${canVote ? `<input type="${inputType}" name="poll-choice" value="${option.id}" ${myVotes.includes(option.id) ? 'checked' : ''}>` : ''}
+                <span class="poll-option-text">${escapeHtml(option.text)}</span>
+                <span class="poll-count">${option.votes} (${share}%)</span>
+                <span class="poll-bar" style="width: ${share}%"></span>
+                ${voters}
+            </label>
+        `;
+    }).join('');
+
+    let status = `${total} voter${total === 1 ? '' : 's'}`;
+    if (poll.maxChoices > 1) status += ` · choose up to ${poll.maxChoices}`;
+    if (poll.anonymous) status += ' · anonymous';
+    if (poll.closesAt) {
+        status += ` · ${poll.closed ? 'closed' : 'closes'} ${new Date(poll.closesAt).toLocaleString()}`;
+    }
+
+    container.innerHTML = `
+        <div class="poll">
+            <form id="poll-form">
+                ${options}
+                <p class="poll-status">${status}</p>
+                ${canVote ? `<button type="submit">${myVotes.length ? 'Change vote' : 'Vote'}</button>` : ''}
+                ${canVote && myVotes.length ? '<button type="button" id="poll-withdraw">Withdraw vote</button>' : ''}
+            </form>
+        </div>
+    `;
+
+    const form = document.getElementById('poll-form');
+    form.addEventListener('submit', e => {
+        e.preventDefault();
+        const chosen = [...form.querySelectorAll('input[name="poll-choice"]:checked')].map(input => parseInt(input.value));
+        if (chosen.length === 0) {
+            notifications.error('Choose an option first');
+            return;
+        }
+        if (chosen.length > poll.maxChoices) {
+            notifications.error(`You can choose at most ${poll.maxChoices} options`);
+            return;
+        }
+        vote(postId, chosen);
+    });
+    document.getElementById('poll-withdraw')?.addEventListener('click', () => vote(postId, []));
+}
+
+function vote(postId, optionIds) {
+    api.post(`/api/posts/${postId}/poll/vote`, { optionIds })
+        .then(data => renderPoll(postId, data.poll))
+        .catch(error => {
+            if (error.message !== 'Session expired') {
+                notifications.error('Vote not recorded: ' + error.message);
+            }
+        });
+}
+
+// handlePollResults shows results pushed to everyone viewing the post.
+function handlePollResults(message) {
+    const { postId, poll } = message.content || {};
+    if (!poll || !currentPoll || currentPoll.postId !== postId) return;
+    renderPoll(postId, { ...poll, myVotes: currentPoll.myVotes });
+}
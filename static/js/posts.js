@@ -1,4 +1,8 @@
-function loadPosts() {
+// postsCategory is the category the post list is filtered to, if any.
+let postsCategory = null;
+
+// loadPosts shows all posts, or only those in category when it is given.
+function loadPosts(category) {
     console.log('Loading posts...');
     
     if (!currentUser) {
@@ -6,10 +10,25 @@ function loadPosts() {
         return;
     }
     
-    api.get('/api/posts')
+    postsCategory = category || null;
+    const url = postsCategory ? `/api/posts?category=${encodeURIComponent(postsCategory)}` : '/api/posts';
+    api.get(url)
         .then(data => {
             console.log(`Received ${data.posts ? data.posts.length : 0} posts`);
             displayPosts(data.posts || []);
+            wsState.lastPostAt = newestPostTime(data.posts || []) || new Date().toISOString();
+            subscribeToFeed(data.topic);
+            
+            if (postsCategory) {
+                const filter = document.createElement('p');
+                filter.className = 'posts-filter';
+                filter.innerHTML = `Showing <strong>${escapeHtml(postsCategory)}</strong> · <a href="#">show all</a>`;
+                filter.querySelector('a').addEventListener('click', e => {
+                    e.preventDefault();
+                    loadPosts();
+                });
+                document.getElementById('posts-container').prepend(filter);
+            }
         })
         .catch(error => {
             if (error.message !== 'Session expired') {
@@ -19,6 +38,54 @@ function loadPosts() {
         });
 }
 
+function loadCategories() {
+    api.get('/api/categories')
+        .then(data => {
+            const select = document.getElementById('post-category');
+            if (!select) return;
+            
+            let html = '<option value="">-- Select Category --</option>';
+            (data.categories || []).forEach(category => {
+                const label = category.name.charAt(0).toUpperCase() + category.name.slice(1);
+                html += `<option value="${escapeHtml(category.name)}">${escapeHtml(label)}</option>`;
+            });
+            select.innerHTML = html;
+        })
+        .catch(error => {
+            if (error.message !== 'Session expired') {
+                console.error('Error loading categories:', error);
+            }
+        });
+}
+
+// collapsible hides content from blocked users behind a toggle.
+function collapsible(collapsed, html) {
+    if (!collapsed) {
+        return html;
+    }
+    return `<details class="collapsed-content"><summary>Hidden: you blocked this user</summary>${html}</details>`;
+}
+
+// reportContent asks for a reason and files a report with the moderators.
+function reportContent(targetType, targetId) {
+    const reason = prompt('Why are you reporting this?');
+    if (!reason || !reason.trim()) {
+        return;
+    }
+    api.post('/api/reports', { targetType, targetId, reason: reason.trim() })
+        .then(() => notifications.success('Report sent to the moderators', 3000))
+        .catch(() => {});
+}
+
+// postBadges labels a post's moderation state next to its title.
+function postBadges(post) {
+    let badges = '';
+    if (post.announcement) badges += ' <span class="post-badge post-announcement">Announcement</span>';
+    if (post.pinned) badges += ' <span class="post-badge post-pinned">Pinned</span>';
+    if (post.locked) badges += ' <span class="post-locked">Locked</span>';
+    return badges;
+}
+
 function displayPosts(posts) {
     console.log(`Displaying ${posts.length} posts`);
     
@@ -44,30 +111,73 @@ function displayPosts(posts) {
     }
     
     posts.forEach(post => {
-        const postElement = document.createElement('div');
-        postElement.className = 'post-item';
-        
-        const title = post.title || 'Untitled';
-        const category = post.category || 'Uncategorized';
-        const content = post.content || 'No content';
-        const userNickname = post.user && post.user.nickname ? post.user.nickname : 'Unknown';
-        const createdDate = post.createdAt ? new Date(post.createdAt).toLocaleString() : 'Unknown date';
-        
-        postElement.innerHTML = `
-            <h3>${title}</h3>
-            <p class="post-category">${category}</p>
-            <p class="post-content">${content}</p>
-            <p class="post-meta">Posted by ${userNickname} on ${createdDate}</p>
-            <button class="view-post-btn" data-id="${post.id}">View Details</button>
-        `;
-        postsContainer.appendChild(postElement);
-        
-        postElement.querySelector('.view-post-btn').addEventListener('click', () => {
-            viewPost(post.id);
-        });
+        postsContainer.appendChild(createPostElement(post));
     });
 }
 
+function createPostElement(post) {
+    const postElement = document.createElement('div');
+    postElement.className = `post-item${post.announcement ? ' announcement' : ''}${post.pinned ? ' pinned' : ''}`;
+    postElement.dataset.postId = post.id;
+    
+    const title = escapeHtml(post.title || 'Untitled');
+    const category = escapeHtml(post.category || 'Uncategorized');
+    const content = post.content ? richContent(post) : 'No content';
+    const userNickname = escapeHtml(post.user && post.user.nickname ? post.user.nickname : 'Unknown');
+    const createdDate = post.createdAt ? new Date(post.createdAt).toLocaleString() : 'Unknown date';
+    
+    postElement.innerHTML = `
+        <h3>${title}${postBadges(post)}${post.unreadComments > 0 ? ` <span class="new-badge">${post.unreadComments} new</span>` : ''}</h3>
+        <p class="post-category">${category}</p>
+        ${collapsible(post.collapsed, `<div class="post-content">${content}</div>`)}
+        <p class="post-meta">Posted by ${userNickname} on ${createdDate}</p>
+        <button class="view-post-btn" data-id="${post.id}">View Details</button>
+    `;
+    
+    postElement.querySelector('.view-post-btn').addEventListener('click', () => {
+        viewPost(post.id);
+    });
+    return postElement;
+}
+
+function newestPostTime(posts) {
+    return posts.reduce((newest, post) => {
+        return post.createdAt && (!newest || new Date(post.createdAt) > new Date(newest)) ? post.createdAt : newest;
+    }, null);
+}
+
+// addNewPost puts a post that arrived over the socket, or while catching
+// up, at the top of the list below the announcements and pinned posts. Posts
+// already shown are skipped.
+function addNewPost(post) {
+    const postsContainer = document.getElementById('posts-list');
+    if (!post || !postsContainer || document.getElementById('posts-container').classList.contains('hidden')) return;
+    if (postsCategory && post.category !== postsCategory) return;
+    if (postsContainer.querySelector(`.post-item[data-post-id="${post.id}"]`)) return;
+    
+    if (!postsContainer.querySelector('.post-item')) {
+        postsContainer.innerHTML = '';
+    }
+    const first = [...postsContainer.querySelectorAll('.post-item')]
+        .find(item => !item.classList.contains('announcement') && !item.classList.contains('pinned'));
+    postsContainer.insertBefore(createPostElement(post), first || null);
+    
+    wsState.lastPostAt = newestPostTime([post, { createdAt: wsState.lastPostAt }]);
+}
+
+// backfillPosts adds the posts created while the socket was down.
+function backfillPosts() {
+    if (!wsState.feedTopic || !wsState.lastPostAt) return;
+    
+    let url = `/api/posts?after=${encodeURIComponent(wsState.lastPostAt)}`;
+    if (postsCategory) {
+        url += `&category=${encodeURIComponent(postsCategory)}`;
+    }
+    api.get(url)
+        .then(data => (data.posts || []).forEach(addNewPost))
+        .catch(error => console.error('Error catching up on posts:', error));
+}
+
 function handleCreatePost(e) {
     e.preventDefault();
     console.log('Creating new post');
@@ -98,10 +208,31 @@ function handleCreatePost(e) {
         category: category
     };
     
+    const publishAt = form.querySelector('#post-publish-at').value;
+    if (publishAt) {
+        postData.publishAt = new Date(publishAt).toISOString();
+    }
+    
+    try {
+        const poll = readPollForm(form);
+        if (poll) postData.poll = poll;
+    } catch (error) {
+        notifications.error(error.message);
+        return;
+    }
+    
     api.post('/api/posts', postData)
         .then(data => {
             console.log('Post created successfully');
             form.reset();
+            document.getElementById('poll-fields').classList.add('hidden');
+            
+            if (data.post?.publishAt) {
+                notifications.success(`Post scheduled for ${new Date(data.post.publishAt).toLocaleString()}`);
+                showSection('scheduled-container');
+                loadScheduled();
+                return;
+            }
             
             showSection('posts-container');
             
@@ -132,7 +263,7 @@ function viewPost(postId) {
                 throw new Error('Invalid post data');
             }
             
-            displayPostDetail(data.post, data.comments || []);
+            displayPostDetail(data.post, data.comments || [], data.following, data.firstUnreadCommentId);
         })
         .catch(error => {
             if (error.message !== 'Session expired') {
@@ -167,28 +298,52 @@ function handleAddComment(postId, commentText) {
         });
 }
 
-function displayPostDetail(post, comments = []) {
+function displayPostDetail(post, comments = [], following = false, firstUnreadCommentId = 0) {
     const postDetailContainer = document.getElementById('post-detail');
     if (!postDetailContainer) {
         console.error('Post detail container not found');
         return;
     }
     
-    const title = post.title || 'Untitled';
-    const category = post.category || 'Uncategorized';
-    const content = post.content || 'No content';
-    const userNickname = post.user && post.user.nickname ? post.user.nickname : 'Unknown';
+    const title = escapeHtml(post.title || 'Untitled');
+    const category = escapeHtml(post.category || 'Uncategorized');
+    const content = post.content ? richContent(post) : 'No content';
+    const userNickname = escapeHtml(post.user && post.user.nickname ? post.user.nickname : 'Unknown');
     const createdDate = post.createdAt ? new Date(post.createdAt).toLocaleString() : 'Unknown date';
     
+    const canDelete = post.userId === currentUser.id || hasPermission('delete_any_post');
+    const canLock = hasPermission('lock_post');
+    const canPin = hasPermission('pin_post');
+    const canAnnounce = hasPermission('announce');
+    const canModerate = canDelete || canLock || canPin || canAnnounce;
+    
     postDetailContainer.innerHTML = `
-        <h2>${title}</h2>
+        <h2>${title}${postBadges(post)}</h2>
         <p class="post-category">${category}</p>
-        <p class="post-content">${content}</p>
+        ${collapsible(post.collapsed, `<div class="post-content">${content}</div>`)}
         <p class="post-meta">Posted by ${userNickname} on ${createdDate}</p>
+        ${post.publishAt ? `<p class="scheduled-notice">Scheduled for ${new Date(post.publishAt).toLocaleString()}. Only you can see this post until then.</p>` : ''}
+        <div id="post-poll"></div>
+        <p id="post-viewers" class="post-viewers"></p>
+        ${canModerate ? `
+        <div class="moderation-controls">
+            ${canLock ? `<button id="lock-post-btn">${post.locked ? 'Unlock' : 'Lock'} Post</button>` : ''}
+            ${canPin ? `
+            <select id="pin-post-select">
+                <option value="" ${!post.pinned ? 'selected' : ''}>Not pinned</option>
+                <option value="category" ${post.pinned === 'category' ? 'selected' : ''}>Pinned in category</option>
+                <option value="global" ${post.pinned === 'global' ? 'selected' : ''}>Pinned everywhere</option>
+            </select>` : ''}
+            ${canAnnounce ? `<button id="announce-post-btn">${post.announcement ? 'Remove Announcement' : 'Make Announcement'}</button>` : ''}
+            ${canDelete ? '<button id="delete-post-btn">Delete Post</button>' : ''}
+        </div>` : ''}
+        <button id="follow-post-btn" class="follow-btn">${following ? 'Unfollow' : 'Follow'}</button>
+        ${post.userId !== currentUser.id ? '<button id="report-post-btn" class="report-btn">Report</button>' : ''}
         <div class="comments-section">
             <h3>Comments</h3>
             <div id="comments-list"></div>
-            <form id="comment-form" data-post-id="${post.id}">
+            ${post.locked ? '<p class="locked-notice">This post is locked. New comments are disabled.</p>' : ''}
+            <form id="comment-form" data-post-id="${post.id}" class="${post.locked || post.publishAt ? 'hidden' : ''}">
                 <div class="form-group">
                     <label for="comment">Add a comment</label>
                     <textarea id="comment" name="comment" required></textarea>
@@ -198,24 +353,101 @@ function displayPostDetail(post, comments = []) {
         </div>
     `;
     
+    renderPoll(post.id, post.poll);
+    subscribeToPost(post.id);
+    renderPostViewers();
+    
+    const lockBtn = document.getElementById('lock-post-btn');
+    if (lockBtn) {
+        lockBtn.addEventListener('click', () => {
+            api.put(`/api/posts/${post.id}/lock`, { locked: !post.locked })
+                .then(() => viewPost(post.id))
+                .catch(error => console.error('Error updating lock:', error));
+        });
+    }
+    
+    const pinSelect = document.getElementById('pin-post-select');
+    if (pinSelect) {
+        pinSelect.addEventListener('change', () => {
+            api.put(`/api/posts/${post.id}/pin`, { pinned: pinSelect.value })
+                .then(() => viewPost(post.id))
+                .catch(error => console.error('Error updating pin:', error));
+        });
+    }
+    
+    const announceBtn = document.getElementById('announce-post-btn');
+    if (announceBtn) {
+        announceBtn.addEventListener('click', () => {
+            api.put(`/api/posts/${post.id}/announcement`, { announcement: !post.announcement })
+                .then(() => viewPost(post.id))
+                .catch(error => console.error('Error updating announcement:', error));
+        });
+    }
+    
+    const deleteBtn = document.getElementById('delete-post-btn');
+    if (deleteBtn) {
+        deleteBtn.addEventListener('click', () => {
+            if (!confirm('Delete this post?')) return;
+            api.delete(`/api/posts/${post.id}`)
+                .then(() => {
+                    notifications.success('Post deleted');
+                    showSection('posts-container');
+                    loadPosts();
+                })
+                .catch(error => console.error('Error deleting post:', error));
+        });
+    }
+    
     const commentsListContainer = document.getElementById('comments-list');
     if (comments.length === 0) {
         commentsListContainer.innerHTML = '<p>No comments yet. Be the first to comment!</p>';
     } else {
         let commentsHTML = '';
         comments.forEach(comment => {
-            const commentUserName = comment.username || 'Unknown';
+            const commentUserName = escapeHtml(comment.username || 'Unknown');
             const commentDate = comment.createdAt ? new Date(comment.createdAt).toLocaleString() : 'Unknown date';
     
             commentsHTML += `
-                <div class="comment-item">
-                    <p class="comment-content">${comment.content}</p>
+                <div class="comment-item${comment.id === firstUnreadCommentId ? ' first-unread' : ''}" id="comment-${comment.id}">
+                    ${collapsible(comment.collapsed, `<div class="comment-content">${richContent(comment)}</div>`)}
                     <p class="comment-meta">Posted by ${commentUserName} on ${commentDate}</p>
+                    ${comment.userId !== currentUser.id ? `<button class="report-btn report-comment-btn" data-id="${comment.id}">Report</button>` : ''}
                 </div>
             `;
         });        commentsListContainer.innerHTML = commentsHTML;
+        
+        commentsListContainer.querySelectorAll('.report-comment-btn').forEach(btn => {
+            btn.addEventListener('click', () => reportContent('comment', parseInt(btn.dataset.id)));
+        });
+        
+        // Jump to where the reader left off.
+        const firstUnread = document.getElementById(`comment-${firstUnreadCommentId}`);
+        if (firstUnread) {
+            firstUnread.scrollIntoView({ behavior: 'smooth', block: 'center' });
+        }
     }
     
+    const followBtn = document.getElementById('follow-post-btn');
+    followBtn.addEventListener('click', () => {
+        const request = following
+            ? api.delete(`/api/posts/${post.id}/follow`)
+            : api.put(`/api/posts/${post.id}/follow`, {});
+        request
+            .then(data => {
+                following = data.following;
+                followBtn.textContent = following ? 'Unfollow' : 'Follow';
+            })
+            .catch(error => console.error('Error updating follow:', error));
+    });
+    
+    const reportBtn = document.getElementById('report-post-btn');
+    if (reportBtn) {
+        reportBtn.addEventListener('click', () => reportContent('post', post.id));
+    }
+    
+    setupMentionAutocomplete(document.getElementById('comment'));
+    drafts.bind(`comment:${post.id}`, { content: document.getElementById('comment') });
+    
     document.getElementById('comment-form').addEventListener('submit', function(e) {
         e.preventDefault();
         handleAddComment(post.id, e.target.comment.value);
@@ -71,8 +71,8 @@ function displayProfilePosts(posts) {
     posts.slice(0, 5).forEach(post => {
         html += `
             <div class="profile-post-item">
-                <h5>${post.title}</h5>
-                <p>${post.content.substring(0, 100)}${post.content.length > 100 ? '...' : ''}</p>
+                <h5>${escapeHtml(post.title)}</h5>
+                <p>${escapeHtml(post.content.substring(0, 100))}${post.content.length > 100 ? '...' : ''}</p>
                 <p class="post-meta">Posted on ${new Date(post.createdAt).toLocaleDateString()}</p>
                 <button class="view-post-btn" data-id="${post.id}">View Post</button>
             </div>
@@ -100,7 +100,7 @@ function displayProfileComments(comments) {
     comments.slice(0, 5).forEach(comment => {
         html += `
             <div class="profile-comment-item">
-                <p>${comment.content.substring(0, 100)}${comment.content.length > 100 ? '...' : ''}</p>
+                <p>${escapeHtml(comment.content.substring(0, 100))}${comment.content.length > 100 ? '...' : ''}</p>
                 <p class="comment-meta">Commented on ${new Date(comment.createdAt).toLocaleDateString()}</p>
                 <button class="view-post-btn" data-id="${comment.postId}">View Post</button>
             </div>
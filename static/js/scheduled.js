@@ -0,0 +1,105 @@
+document.addEventListener('DOMContentLoaded', function() {
+    const scheduledBtn = document.getElementById('scheduled-btn');
+    if (scheduledBtn) {
+        scheduledBtn.addEventListener('click', () => {
+            showSection('scheduled-container');
+            loadScheduled();
+        });
+    }
+});
+
+// toLocalInput formats a timestamp for a datetime-local input.
+function toLocalInput(value) {
+    const date = new Date(value);
+    const pad = n => String(n).padStart(2, '0');
+    return `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())}T${pad(date.getHours())}:${pad(date.getMinutes())}`;
+}
+
+function loadScheduled() {
+    api.get('/api/scheduled-posts')
+        .then(data => displayScheduled(data.posts || []))
+        .catch(error => {
+            if (error.message !== 'Session expired') {
+                console.error('Error loading scheduled posts:', error);
+            }
+        });
+}
+
+function displayScheduled(posts) {
+    const container = document.getElementById('scheduled-posts');
+    
+    if (posts.length === 0) {
+        container.innerHTML = '<p>No scheduled posts. Pick a publish time when creating a post to schedule it.</p>';
+        return;
+    }
+    
+    container.innerHTML = posts.map(post => `
+        <div class="scheduled-item" data-id="${post.id}">
+            <h3>${escapeHtml(post.title)}</h3>
+            <p class="post-meta">in ${escapeHtml(post.category)} · publishes ${new Date(post.publishAt).toLocaleString()}</p>
+            <button class="preview-scheduled-btn">Preview</button>
+            <button class="edit-scheduled-btn">Edit</button>
+            <button class="cancel-scheduled-btn">Cancel</button>
+        </div>
+    `).join('');
+    
+    container.querySelectorAll('.scheduled-item').forEach((item, i) => {
+        const post = posts[i];
+        item.querySelector('.preview-scheduled-btn').addEventListener('click', () => viewPost(post.id));
+        item.querySelector('.edit-scheduled-btn').addEventListener('click', () => editScheduled(item, post));
+        item.querySelector('.cancel-scheduled-btn').addEventListener('click', () => {
+            if (!confirm('Cancel this scheduled post? It will be deleted.')) return;
+            api.delete(`/api/scheduled-posts/${post.id}`)
+                .then(() => {
+                    notifications.success('Scheduled post cancelled');
+                    loadScheduled();
+                })
+                .catch(error => console.error('Error cancelling scheduled post:', error));
+        });
+    });
+}
+
+function editScheduled(item, post) {
+    const categories = document.getElementById('post-category').innerHTML;
+    
+    item.innerHTML = `
+        <form class="scheduled-edit-form">
+            <div class="form-group">
+                <label>Title</label>
+                <input type="text" name="title" value="${escapeHtml(post.title)}" required>
+            </div>
+            <div class="form-group">
+                <label>Category</label>
+                <select name="category" required>${categories}</select>
+            </div>
+            <div class="form-group">
+                <label>Content</label>
+                <textarea name="content" rows="6" required>${escapeHtml(post.content)}</textarea>
+            </div>
+            <div class="form-group">
+                <label>Publish at</label>
+                <input type="datetime-local" name="publishAt" value="${toLocalInput(post.publishAt)}" required>
+            </div>
+            <button type="submit">Save</button>
+            <button type="button" class="cancel-edit-btn">Discard changes</button>
+        </form>
+    `;
+    
+    const form = item.querySelector('form');
+    form.category.value = post.category;
+    form.querySelector('.cancel-edit-btn').addEventListener('click', loadScheduled);
+    form.addEventListener('submit', e => {
+        e.preventDefault();
+        api.put(`/api/scheduled-posts/${post.id}`, {
+            title: form.title.value.trim(),
+            category: form.category.value,
+            content: form.content.value.trim(),
+            publishAt: new Date(form.publishAt.value).toISOString()
+        })
+            .then(() => {
+                notifications.success('Scheduled post updated');
+                loadScheduled();
+            })
+            .catch(error => console.error('Error updating scheduled post:', error));
+    });
+}